@@ -0,0 +1,205 @@
+package fcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "github.com/univero/fcache/fcache/cachepb"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A BatchGetter is a Getter which can load many keys at once, e.g. by one query of the database
+// the Group checks whether the getter implements it in GetMany
+type BatchGetter interface {
+	Getter
+	// GetMany returns the data of the keys, a key absent in the map is treated as not found,
+	// the loaded data never expires
+	GetMany(ctx context.Context, keys []string) (map[string][]byte, error)
+}
+
+// batchResult collects the values and the errors of the keys concurrently
+type batchResult struct {
+	mu    sync.Mutex
+	views map[string]ByteView
+	errs  map[string]error
+}
+
+// set records the value or the error of the key
+func (r *batchResult) set(key string, value ByteView, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.errs[key] = err
+		return
+	}
+	r.views[key] = value
+}
+
+// GetMany returns the values of the keys
+// the hits are served locally, the misses are grouped by their owner peer
+// and loaded with one request per peer, the keys owned by this peer are loaded
+// by the getter, at once if it implements BatchGetter
+// the keys failed to load are absent in the map, and their errors are joined
+func (g *Group) GetMany(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	views, errs := g.getMany(ctx, keys)
+	joined := make([]error, 0, len(errs))
+	for _, key := range keys {
+		if err, ok := errs[key]; ok {
+			joined = append(joined, fmt.Errorf("%s: %w", key, err))
+			delete(errs, key)
+		}
+	}
+	return views, errors.Join(joined...)
+}
+
+// getMany returns the values and the errors of the keys separately
+func (g *Group) getMany(ctx context.Context, keys []string) (map[string]ByteView, map[string]error) {
+	res := &batchResult{
+		views: make(map[string]ByteView, len(keys)),
+		errs:  make(map[string]error),
+	}
+	seen := make(map[string]struct{}, len(keys))
+	owners := make(map[PeerGetter][]string)
+	var local []string
+	for _, key := range keys {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		if key == "" {
+			res.set(key, ByteView{}, fmt.Errorf("key is required"))
+			continue
+		}
+		g.stats.gets.Add(1)
+		if v, ok := g.lookupCache(key); ok {
+			g.stats.cacheHits.Add(1)
+			if v.notFound {
+				res.set(key, ByteView{}, notFoundError(key))
+			} else {
+				res.set(key, v, nil)
+			}
+			continue
+		}
+		if g.peers != nil && !isForwarded(ctx) {
+			if peer, ok := g.peers.PickPeer(key); ok {
+				owners[peer] = append(owners[peer], key)
+				continue
+			}
+		}
+		local = append(local, key)
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for peer, peerKeys := range owners {
+		wg.Add(1)
+		go func(peer PeerGetter, peerKeys []string) {
+			defer wg.Done()
+			// like load, the keys failed in the peer are loaded locally
+			failed := g.getManyFromPeer(ctx, peer, peerKeys, res)
+			mu.Lock()
+			local = append(local, failed...)
+			mu.Unlock()
+		}(peer, peerKeys)
+	}
+	wg.Wait()
+
+	g.getManyLocally(ctx, local, res)
+	return res.views, res.errs
+}
+
+// getManyFromPeer sends all keys to the peer in one request,
+// and returns the keys failed to get from the peer
+func (g *Group) getManyFromPeer(ctx context.Context, peer PeerGetter, keys []string, res *batchResult) []string {
+	req := &pb.BatchRequest{
+		Group: g.name,
+		Keys:  keys,
+	}
+	resp := &pb.BatchResponse{}
+	start := time.Now()
+	if err := peer.GetMany(ctx, req, resp); err != nil {
+		g.stats.peerErrors.Add(1)
+		g.log().Warn("failed to get many from peer", "group", g.name, "keys", len(keys), "peer", peer.String(),
+			"latency", time.Since(start), "err", err)
+		return keys
+	}
+	g.log().Debug("load many from peer", "group", g.name, "keys", len(keys), "peer", peer.String(),
+		"latency", time.Since(start))
+
+	got := make(map[string]struct{}, len(keys))
+	for _, kv := range resp.GetValues() {
+		if kv.GetError() != "" {
+			continue
+		}
+		g.stats.peerLoads.Add(1)
+		if kv.GetNotFound() {
+			if value, ok := g.notFoundView(); ok {
+				g.populateHotCache(kv.GetKey(), value)
+			}
+			res.set(kv.GetKey(), ByteView{}, notFoundError(kv.GetKey()))
+			got[kv.GetKey()] = struct{}{}
+			continue
+		}
+		value := newPeerView(kv.GetValue(), kv.GetExpire())
+		g.populateHotCache(kv.GetKey(), value)
+		res.set(kv.GetKey(), value, nil)
+		got[kv.GetKey()] = struct{}{}
+	}
+	var failed []string
+	for _, key := range keys {
+		if _, ok := got[key]; !ok {
+			failed = append(failed, key)
+		}
+	}
+	return failed
+}
+
+// getManyLocally uses the getter to load the keys,
+// at once if it's a BatchGetter, otherwise one by one
+func (g *Group) getManyLocally(ctx context.Context, keys []string, res *batchResult) {
+	if len(keys) == 0 {
+		return
+	}
+	if bg, ok := g.getter.(BatchGetter); ok {
+		values, err := bg.GetMany(ctx, keys)
+		for _, key := range keys {
+			b, ok := values[key]
+			if !ok {
+				keyErr := err
+				if keyErr == nil {
+					keyErr = notFoundError(key)
+					if value, ok := g.notFoundView(); ok {
+						g.populateCache(key, value, &g.mainCache)
+					}
+				}
+				g.stats.localLoadErrs.Add(1)
+				res.set(key, ByteView{}, keyErr)
+				continue
+			}
+			g.stats.localLoads.Add(1)
+			value := ByteView{b: b}
+			g.populateCache(key, value, &g.mainCache)
+			res.set(key, value, nil)
+		}
+		return
+	}
+	for _, key := range keys {
+		var leader atomic.Bool
+		viewi, err, shared := g.loader.DoContext(ctx, key, func(ctx context.Context) (any, error) {
+			leader.Store(true)
+			return g.getLocally(ctx, key)
+		})
+		if shared && !leader.Load() {
+			g.stats.loadsDeduped.Add(1)
+		}
+		if err != nil {
+			res.set(key, ByteView{}, err)
+			continue
+		}
+		res.set(key, viewi.(ByteView), nil)
+	}
+}
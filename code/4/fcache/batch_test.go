@@ -0,0 +1,64 @@
+package fcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// batchGetter loads many keys from db at once
+type batchGetter struct {
+	calls int
+}
+
+func (g *batchGetter) Get(ctx context.Context, key string) ([]byte, error) {
+	return nil, fmt.Errorf("key %s should be loaded in batch", key)
+}
+
+func (g *batchGetter) GetMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	g.calls++
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if v, ok := db[key]; ok {
+			values[key] = []byte(v)
+		}
+	}
+	return values, nil
+}
+
+func TestGetManyLocally(t *testing.T) {
+	getter := &batchGetter{}
+	g := NewGroup("many-local", 2<<10, getter)
+	defer g.Close()
+	if _, err := g.Get(context.Background(), "Tom"); err == nil {
+		t.Fatal("Tom should be loaded in batch only")
+	}
+	views, err := g.GetMany(context.Background(), []string{"Tom", "Jack", "Tom", "unknown"})
+	if err == nil || len(views) != 2 || views["Tom"].String() != "630" || views["Jack"].String() != "589" {
+		t.Fatalf("expect Tom and Jack loaded and unknown failed, but %v %v got", views, err)
+	}
+	if getter.calls != 1 {
+		t.Fatalf("the keys should be loaded by one call, but %d calls", getter.calls)
+	}
+	if _, err := g.GetMany(context.Background(), []string{"Tom", "Jack"}); err != nil || getter.calls != 1 {
+		t.Fatal("Tom and Jack should be cached")
+	}
+}
+
+func TestGetManyFromPeer(t *testing.T) {
+	g := NewGroup("many-peer", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("key %s should be loaded from peer", key)
+		}))
+	defer g.Close()
+	peer := &fakePeer{}
+	g.RegisterPeers(&fakePicker{peer: peer})
+	keys := []string{"Tom", "Jack", "Sam"}
+	views, err := g.GetMany(context.Background(), keys)
+	if err != nil || len(views) != len(keys) {
+		t.Fatalf("failed to get many keys from peer: %v", err)
+	}
+	if peer.batchCalls != 1 || peer.calls != 0 {
+		t.Fatal("the keys should be sent to the peer in one batch")
+	}
+}
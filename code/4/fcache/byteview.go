@@ -1,10 +1,16 @@
 package fcache
 
+import "time"
+
 // A ByteView holds an immutable view of bytes
 // It's one of the most important structure in the fcache
 // b is only read
 type ByteView struct {
 	b []byte
+	// e is the expire time, the zero time means never expire
+	e time.Time
+	// notFound marks the negative entry of the key which isn't found by the getter
+	notFound bool
 }
 
 // Len returns the view's length
@@ -13,6 +19,11 @@ func (v ByteView) Len() int {
 	return len(v.b)
 }
 
+// Expire returns the expire time of the view, the zero time means never expire
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
 // ByteSlice return a new slice which is deeplyEqual with the field b
 func (v ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b)
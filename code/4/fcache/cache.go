@@ -8,31 +8,178 @@ import (
 // cache encapsulates the lru, and add the Mutex to keep mutual exclusion in the concurrence
 type cache struct {
 	mu         sync.Mutex
-	lru        *lru.Cache
+	lru        lru.Policy
+	policy     lru.PolicyType
 	cacheBytes int64
+	// the counters of the cache, guarded by mu
+	nget, nhit, nevict int64
 }
 
-// add the key and value mutually exclusive
+// add the key and value mutually exclusive, the value expires at value.Expire()
 func (c *cache) add(key string, value ByteView) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+		c.lru = lru.NewPolicy(c.policy, c.cacheBytes, func(string, lru.Value) {
+			c.nevict++
+		})
 	}
-	c.lru.Add(key, value)
+	c.lru.AddWithExpire(key, value, value.Expire())
+	// the lru keeps the cacheBytes it's created with, so a shrunk cache evicts by itself
+	c.evictOver()
 }
 
-// get the value of the key mutually exclusive
+// resize changes the cacheBytes mutually exclusive, the oldest entries are evicted until they fit
+func (c *cache) resize(cacheBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cacheBytes = cacheBytes
+	c.evictOver()
+}
+
+// evictOver removes the oldest entries over the cacheBytes, it must be called with c.mu held
+func (c *cache) evictOver() {
+	for c.lru != nil && c.cacheBytes > 0 && c.lru.Len() > 0 && c.lru.Bytes() > c.cacheBytes {
+		c.lru.RemoveOldest()
+	}
+}
+
+// stats returns the statistics mutually exclusive
+func (c *cache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := CacheStats{Gets: c.nget, Hits: c.nhit, Evictions: c.nevict}
+	if c.lru != nil {
+		s.Bytes = c.lru.Bytes()
+		s.Items = int64(c.lru.Len())
+	}
+	return s
+}
+
+// remove the key mutually exclusive
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru != nil {
+		c.lru.Remove(key)
+	}
+}
+
+// removeExpired discard the expired entries mutually exclusive
+func (c *cache) removeExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return 0
+	}
+	return c.lru.RemoveExpired()
+}
+
+// get the value of the key mutually exclusive, the expired value is a miss
 func (c *cache) get(key string) (value ByteView, ok bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.nget++
 	if c.lru == nil {
 		return
 	}
 
 	if v, ok := c.lru.Get(key); ok {
+		c.nhit++
 		return v.(ByteView), ok
 	}
 
 	return
 }
+
+// shardedCache splits the keys into shards by the hash of key,
+// every shard is a cache with its own Mutex, so the visits of different shards don't block each other
+type shardedCache struct {
+	shards []cache
+}
+
+// newShardedCache initialise n shards, the cacheBytes is divided evenly across them,
+// there are fewer shards if the cacheBytes is less than n, since zero bytes means no limit in lru
+func newShardedCache(cacheBytes int64, n int, policy lru.PolicyType) shardedCache {
+	if n < 1 {
+		n = 1
+	}
+	if cacheBytes > 0 && cacheBytes < int64(n) {
+		n = int(cacheBytes)
+	}
+	s := shardedCache{shards: make([]cache, n)}
+	for i := range s.shards {
+		s.shards[i].policy = policy
+		s.shards[i].cacheBytes = cacheBytes / int64(n)
+		// the remainder goes to the first shards, so the shards sum up to the cacheBytes
+		if int64(i) < cacheBytes%int64(n) {
+			s.shards[i].cacheBytes++
+		}
+	}
+	return s
+}
+
+// resize divides the new cacheBytes across the shards like newShardedCache,
+// the number of shards is kept, so the keys stay in their shards
+func (s *shardedCache) resize(cacheBytes int64) {
+	n := int64(len(s.shards))
+	for i := range s.shards {
+		b := cacheBytes / n
+		if int64(i) < cacheBytes%n {
+			b++
+		}
+		// zero bytes means no limit in lru
+		s.shards[i].resize(max(b, 1))
+	}
+}
+
+// shard returns the shard of the key by FNV-1a
+func (s *shardedCache) shard(key string) *cache {
+	if len(s.shards) == 1 {
+		return &s.shards[0]
+	}
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &s.shards[h%uint32(len(s.shards))]
+}
+
+// add the key and value into its shard
+func (s *shardedCache) add(key string, value ByteView) {
+	s.shard(key).add(key, value)
+}
+
+// get the value of the key from its shard
+func (s *shardedCache) get(key string) (value ByteView, ok bool) {
+	return s.shard(key).get(key)
+}
+
+// remove the key from its shard
+func (s *shardedCache) remove(key string) {
+	s.shard(key).remove(key)
+}
+
+// stats sums the statistics of all shards
+func (s *shardedCache) stats() CacheStats {
+	var sum CacheStats
+	for i := range s.shards {
+		st := s.shards[i].stats()
+		sum.Bytes += st.Bytes
+		sum.Items += st.Items
+		sum.Gets += st.Gets
+		sum.Hits += st.Hits
+		sum.Evictions += st.Evictions
+	}
+	return sum
+}
+
+// removeExpired discard the expired entries of all shards one by one
+func (s *shardedCache) removeExpired() int {
+	n := 0
+	for i := range s.shards {
+		n += s.shards[i].removeExpired()
+	}
+	return n
+}
@@ -0,0 +1,91 @@
+package fcache
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func TestShardedCache(t *testing.T) {
+	c := newShardedCache(1024, 8, 0)
+	for i := range c.shards {
+		if c.shards[i].cacheBytes != 128 {
+			t.Fatalf("the cacheBytes should be divided across shards, but %d got", c.shards[i].cacheBytes)
+		}
+	}
+	for i := 0; i < 64; i++ {
+		k := strconv.Itoa(i)
+		c.add(k, ByteView{b: []byte(k)})
+	}
+	for i := 0; i < 64; i++ {
+		k := strconv.Itoa(i)
+		if v, ok := c.get(k); !ok || v.String() != k {
+			t.Fatalf("failed to get the key: %s", k)
+		}
+	}
+	used := 0
+	for i := range c.shards {
+		if c.shards[i].lru != nil && c.shards[i].lru.Len() > 0 {
+			used++
+		}
+	}
+	if used < 2 {
+		t.Fatalf("the keys should be spread over shards, but only %d used", used)
+	}
+}
+
+func TestShardedCacheSmallBudget(t *testing.T) {
+	for _, tc := range []struct {
+		cacheBytes int64
+		n, shards  int
+	}{{15, 16, 15}, {1030, 8, 8}, {0, 4, 4}} {
+		c := newShardedCache(tc.cacheBytes, tc.n, 0)
+		if len(c.shards) != tc.shards {
+			t.Fatalf("expect %d shards, but %d got", tc.shards, len(c.shards))
+		}
+		var sum int64
+		for i := range c.shards {
+			if tc.cacheBytes > 0 && c.shards[i].cacheBytes < 1 {
+				t.Fatal("every shard should have some bytes, zero means no limit")
+			}
+			sum += c.shards[i].cacheBytes
+		}
+		if sum != tc.cacheBytes {
+			t.Fatalf("the shards should sum up to %d bytes, but %d got", tc.cacheBytes, sum)
+		}
+	}
+
+	c := newShardedCache(14, 16, 0)
+	for i := 0; i < 1000; i++ {
+		k := strconv.Itoa(i)
+		c.add(k, ByteView{b: []byte(k)})
+	}
+	if bytes := c.stats().Bytes; bytes > 14 {
+		t.Fatalf("the cache should keep to its budget of 14 bytes, but %d got", bytes)
+	}
+}
+
+// BenchmarkCacheGetParallel compares the hit throughput of different number of shards,
+// one shard is the cache guarded by the single global Mutex
+func BenchmarkCacheGetParallel(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	for _, n := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("shards-%d", n), func(b *testing.B) {
+			c := newShardedCache(0, n, 0)
+			for _, k := range keys {
+				c.add(k, ByteView{b: []byte(k)})
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					c.get(keys[i%len(keys)])
+					i++
+				}
+			})
+		})
+	}
+}
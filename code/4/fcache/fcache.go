@@ -1,36 +1,125 @@
 package fcache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	pb "github.com/univero/fcache/fcache/cachepb"
+	"github.com/univero/fcache/fcache/lru"
 	"github.com/univero/fcache/fcache/singleflight"
-	"log"
+	"log/slog"
+	"math/rand"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+const (
+	// defaultJanitorInterval how often the expired entries are reclaimed
+	defaultJanitorInterval = time.Minute
+	// defaultShards the mainCache isn't split by default, so the cacheBytes is an exact budget
+	defaultShards = 1
+	// defaultHotCacheDivisor the hotCache takes 1/8 of the cacheBytes by default once the peers are registered
+	defaultHotCacheDivisor = 8
+	// hotCacheSample one in hotCacheSample values loaded from peers is put in the hotCache
+	hotCacheSample = 10
+)
+
+// ErrNotFound is returned by the Getter if the key doesn't exist in the data source,
+// the error wrapping it is cached for a while by the Group with the negative caching
+// and told apart from the other errors by the peers
+var ErrNotFound = errors.New("not found")
+
+// notFoundError is returned for the key which isn't found
+func notFoundError(key string) error {
+	return fmt.Errorf("%s %w", key, ErrNotFound)
+}
+
 // A Getter loads data for a key
 type Getter interface {
-	// Get is a callback function,
-	Get(key string) ([]byte, error)
+	// Get is a callback function, ctx is the one passed to Group.Get,
+	// it carries the deadline and the cancellation of the load
+	Get(ctx context.Context, key string) ([]byte, error)
 }
 
-// A GetterFunc implements Getter with a function
+// A GetterFunc implements Getter with a function which doesn't care about the context
 type GetterFunc func(key string) ([]byte, error)
 
 // Get implements Getter interface function.
 // interface function, only one function in the interface can be used.
 // with it, we can use both struct and func as the parameter.
-func (f GetterFunc) Get(key string) ([]byte, error) {
+func (f GetterFunc) Get(_ context.Context, key string) ([]byte, error) {
 	return f(key)
 }
 
+// A ContextGetterFunc implements Getter with a context-aware function
+type ContextGetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+// Get implements Getter interface function
+func (f ContextGetterFunc) Get(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// An ExpireGetter is a Getter which also tells when the loaded data expires
+// the Group checks whether the getter implements it
+type ExpireGetter interface {
+	Getter
+	// GetWithExpire returns the data and its expire time, the zero time means never expire
+	GetWithExpire(ctx context.Context, key string) ([]byte, time.Time, error)
+}
+
+// A ExpireGetterFunc implements ExpireGetter with a function
+type ExpireGetterFunc func(ctx context.Context, key string) ([]byte, time.Time, error)
+
+// Get implements Getter interface function, the expire time is dropped
+func (f ExpireGetterFunc) Get(ctx context.Context, key string) ([]byte, error) {
+	b, _, err := f(ctx, key)
+	return b, err
+}
+
+// GetWithExpire implements ExpireGetter interface function
+func (f ExpireGetterFunc) GetWithExpire(ctx context.Context, key string) ([]byte, time.Time, error) {
+	return f(ctx, key)
+}
+
 // A Group is a cache namespace and associated data loaded spread over
 type Group struct {
-	name      string
-	getter    Getter
-	mainCache cache
-	peers     PeerPicker
-	loader    *singleflight.Group
+	name   string
+	getter Getter
+	// mainCache keeps the keys owned by this peer
+	mainCache shardedCache
+	// hotCache keeps some of the keys owned by the other peers, which are loaded from them,
+	// so that a popular key doesn't send every request to its owner
+	hotCache shardedCache
+	// the bytes taken from the cacheBytes for the hotCache, zero disables the hotCache,
+	// hotCacheSet tells whether it's set by WithHotCacheBytes, otherwise it's 1/8 of the cacheBytes,
+	// which is taken from the mainCache by RegisterPeers
+	hotCacheBytes int64
+	hotCacheSet   bool
+	// the hotCache is only used with the peers unless it's set by WithHotCacheBytes
+	hotCacheEnabled atomic.Bool
+	cacheBytes      int64
+	peers           PeerPicker
+	loader          *singleflight.Group
+	stats           groupStats
+	// how often the janitor reclaims the expired entries, zero means no janitor
+	janitorInterval time.Duration
+	// closed by Close to stop the janitor
+	done      chan struct{}
+	closeOnce sync.Once
+	// the eviction strategy and the number of shards of the mainCache and the hotCache
+	policy lru.PolicyType
+	shards int
+	// the number of the owners of a key, the owners are tried in order on load
+	replication int
+	// how long a peer holds the lease to load a key after its owners failed, zero disables the lease
+	leaseTTL time.Duration
+	// the leases of the keys for which this peer is the coordinator
+	leases leaseTable
+	// how long the keys not found are cached, zero disables the negative caching
+	negativeTTL time.Duration
+	// nil means slog.Default()
+	logger *slog.Logger
 }
 
 var (
@@ -39,17 +128,44 @@ var (
 )
 
 // NewGroup initialise a group, and set it in the map called groups
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+// the options are applied in order, e.g. WithPolicy(lru.LFU)
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil getter")
 	}
 	mu.Lock()
 	defer mu.Unlock()
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+		name:   name,
+		getter: getter,
+		loader: &singleflight.Group{},
+		// the expired entries are reclaimed periodically by default
+		janitorInterval: defaultJanitorInterval,
+		shards:          defaultShards,
+		cacheBytes:      cacheBytes,
+		done:            make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if !g.hotCacheSet {
+		g.hotCacheBytes = cacheBytes / defaultHotCacheDivisor
+	}
+	g.hotCacheBytes = max(min(g.hotCacheBytes, cacheBytes), 0)
+	mainBytes := cacheBytes - g.hotCacheBytes
+	if !g.hotCacheSet {
+		// a standalone group has nothing to keep in the hotCache, the bytes are taken by RegisterPeers
+		mainBytes = cacheBytes
+	}
+	g.mainCache = newShardedCache(mainBytes, g.shards, g.policy)
+	g.hotCache = newShardedCache(g.hotCacheBytes, g.shards, g.policy)
+	g.hotCacheEnabled.Store(g.hotCacheSet && g.hotCacheBytes > 0)
+	if g.janitorInterval > 0 {
+		go g.janitor()
+	}
+	// the replaced group isn't reachable by name any more, so its janitor is stopped
+	if old, ok := groups[name]; ok {
+		old.stop()
 	}
 	groups[name] = g
 	return g
@@ -67,73 +183,332 @@ func GetGroup(name string) *Group {
 // Get returns the value according to the key
 // if the key is empty, it will return a new ByteView and log an error
 // if the key doesn't exist, try to load it from the other data source
-func (g *Group) Get(key string) (ByteView, error) {
+func (g *Group) Get(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
 
-	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[Fcache] Fcache hit", key, "get", v)
+	g.stats.gets.Add(1)
+	if v, ok := g.lookupCache(key); ok {
+		g.stats.cacheHits.Add(1)
+		g.log().Debug("cache hit", "group", g.name, "key", key)
+		if v.notFound {
+			return ByteView{}, notFoundError(key)
+		}
 		return v, nil
 	}
 
-	return g.load(key)
+	return g.load(ctx, key)
+}
+
+// Set puts the value of the key into the local cache, it expires at expire,
+// the zero time means never expire
+func (g *Group) Set(key string, value []byte, expire time.Time) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	g.populateCache(key, ByteView{b: cloneBytes(value), e: expire}, &g.mainCache)
+	return nil
 }
 
-// RegisterPeers registers a PeerPicker for choosing remoter peer
+// lookupCache checks the mainCache firstly and then the hotCache
+func (g *Group) lookupCache(key string) (value ByteView, ok bool) {
+	if value, ok = g.mainCache.get(key); ok {
+		return
+	}
+	if g.hotCacheEnabled.Load() {
+		value, ok = g.hotCache.get(key)
+	}
+	return
+}
+
+// Remove drops the key from this peer and the owner peer,
+// and broadcasts it to the other peers which may keep the key in their hotCache
+func (g *Group) Remove(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+
+	var owner PeerGetter
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			owner = peer
+			// remove from the owner firstly, so that this peer won't load the old value from it again
+			if err := g.removeFromPeer(ctx, owner, key); err != nil {
+				return err
+			}
+		}
+	}
+	g.localRemove(key)
+	if g.peers == nil {
+		return nil
+	}
+
+	var (
+		wg   sync.WaitGroup
+		emu  sync.Mutex
+		errs []error
+	)
+	for _, peer := range g.peers.GetAll() {
+		if peer == owner {
+			continue
+		}
+		wg.Add(1)
+		go func(peer PeerGetter) {
+			defer wg.Done()
+			if err := g.removeFromPeer(ctx, peer, key); err != nil {
+				emu.Lock()
+				errs = append(errs, err)
+				emu.Unlock()
+			}
+		}(peer)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// localRemove drops the key from the mainCache and the hotCache of this peer
+func (g *Group) localRemove(key string) {
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+}
+
+// RegisterPeers registers a PeerPicker for choosing remoter peer,
+// the hotCache takes 1/8 of the cacheBytes from the mainCache unless it's set by WithHotCacheBytes
 func (g *Group) RegisterPeers(peers PeerPicker) {
 	if g.peers != nil {
 		panic("RegisterPeer called more than once")
 	}
 	g.peers = peers
+	// the mainCache shrinks in place, so the cached entries are kept as long as they fit
+	if !g.hotCacheSet && g.hotCacheBytes > 0 {
+		g.mainCache.resize(g.cacheBytes - g.hotCacheBytes)
+		g.hotCacheEnabled.Store(true)
+	}
 }
 
 // load data from other data source
 // it will be expanded latter
-func (g *Group) load(key string) (value ByteView, err error) {
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
-		if g.peers != nil {
-			if peer, ok := g.peers.PickPeer(key); ok {
-				if value, err = g.getFromPeer(peer, key); err == nil {
-					return value, nil
-				}
-				log.Println("[Fcache] Failed to get from peer", peer, "with key", key)
+func (g *Group) load(ctx context.Context, key string) (ByteView, error) {
+	// the load is cancelled only if all callers of the key go away,
+	// fn runs in its own goroutine and may outlive this caller, so it only writes its own variables,
+	// except leader, which tells whether this caller did the load
+	var leader atomic.Bool
+	viewi, err, shared := g.loader.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+		leader.Store(true)
+		var (
+			peers   []PeerGetter
+			replica bool
+		)
+		if !isForwarded(ctx) {
+			peers, replica = g.pickPeers(key)
+		}
+		for _, peer := range peers {
+			start := time.Now()
+			value, err := g.getFromPeer(ctx, peer, key, replica)
+			if err == nil {
+				g.stats.peerLoads.Add(1)
+				g.log().Debug("load from peer", "group", g.name, "key", key, "peer", peer.String(),
+					"latency", time.Since(start))
+				return value, nil
 			}
+			if errors.Is(err, ErrNotFound) {
+				// the owner has answered, the key isn't loaded locally again
+				g.stats.peerLoads.Add(1)
+				return ByteView{}, err
+			}
+			g.stats.peerErrors.Add(1)
+			g.log().Warn("failed to get from peer", "group", g.name, "key", key, "peer", peer.String(),
+				"latency", time.Since(start), "err", err)
+		}
+		if g.leaseTTL > 0 && len(peers) > 0 {
+			return g.loadWithLease(ctx, key, peers)
 		}
-		return g.getLocally(key)
+		return g.getLocally(ctx, key)
 	})
+	// shared is also true for the leader, only the waiters are deduped
+	if shared && !leader.Load() {
+		g.stats.loadsDeduped.Add(1)
+	}
+	// the stack of the panic is only logged, the error may be sent to the peers and the users
+	var pe *singleflight.PanicError
+	if errors.As(err, &pe) && leader.Load() {
+		g.log().Error("load panicked", "group", g.name, "key", key, "panic", pe.Value, "stack", string(pe.Stack))
+	}
 	if err != nil {
-		return viewi.(ByteView), err
+		return ByteView{}, err
 	}
-	return
+	return viewi.(ByteView), nil
+}
+
+// forwardedKey is the context key which marks the requests from a peer
+type forwardedKey struct{}
+
+// withForwarded marks ctx as a request from a peer, the peer has picked this peer as the owner
+// after skipping the down or the full owners, so the key is loaded here rather than routed back
+func withForwarded(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forwardedKey{}, true)
+}
+
+// isForwarded reports whether ctx is a request from a peer
+func isForwarded(ctx context.Context) bool {
+	forwarded, _ := ctx.Value(forwardedKey{}).(bool)
+	return forwarded
+}
+
+// pickPeers returns the peers to load the key from in order,
+// and whether this peer is a replica of the key
+func (g *Group) pickPeers(key string) ([]PeerGetter, bool) {
+	if g.peers == nil {
+		return nil, false
+	}
+	if rp, ok := g.peers.(ReplicaPicker); ok && g.replication > 1 {
+		return rp.PickPeers(key, g.replication)
+	}
+	if peer, ok := g.peers.PickPeer(key); ok {
+		return []PeerGetter{peer}, false
+	}
+	return nil, false
 }
 
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+// getFromPeer loads the key from the peer, the value is kept in the mainCache if this peer is a replica,
+// otherwise it may be sampled into the hotCache
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string, replica bool) (ByteView, error) {
 	req := &pb.Request{
 		Group: g.name,
 		Key:   key,
 	}
 	resp := &pb.Response{}
-	err := peer.Get(req, resp)
+	err := peer.Get(ctx, req, resp)
 	if err != nil {
 		return ByteView{}, err
 	}
-	return ByteView{b: resp.Value}, nil
+	if resp.GetNotFound() {
+		if value, ok := g.notFoundView(); ok {
+			if replica {
+				g.populateCache(key, value, &g.mainCache)
+			} else {
+				g.populateHotCache(key, value)
+			}
+		}
+		return ByteView{}, notFoundError(key)
+	}
+	value := newPeerView(resp.Value, resp.Expire)
+	if replica {
+		g.populateCache(key, value, &g.mainCache)
+	} else {
+		g.populateHotCache(key, value)
+	}
+	return value, nil
+}
+
+// newPeerView builds the ByteView of the value and the unix nano expire time from a peer
+func newPeerView(b []byte, expire int64) ByteView {
+	value := ByteView{b: b}
+	if expire != 0 {
+		value.e = time.Unix(0, expire)
+	}
+	return value
+}
+
+// populateHotCache samples the value loaded from a peer into the hotCache,
+// the popular keys are more likely to be sampled
+func (g *Group) populateHotCache(key string, value ByteView) {
+	if g.hotCacheEnabled.Load() && rand.Intn(hotCacheSample) == 0 {
+		g.populateCache(key, value, &g.hotCache)
+	}
+}
+
+func (g *Group) removeFromPeer(ctx context.Context, peer PeerGetter, key string) error {
+	req := &pb.Request{
+		Group: g.name,
+		Key:   key,
+	}
+	return peer.Remove(ctx, req)
+}
+
+// log returns the logger of the group
+func (g *Group) log() *slog.Logger {
+	if g.logger == nil {
+		return slog.Default()
+	}
+	return g.logger
 }
 
 // getLocally uses the getter to load the missing key
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+// the expire time is given by the getter if it implements ExpireGetter
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	var (
+		bytes  []byte
+		expire time.Time
+		err    error
+	)
+	start := time.Now()
+	if eg, ok := g.getter.(ExpireGetter); ok {
+		bytes, expire, err = eg.GetWithExpire(ctx, key)
+	} else {
+		bytes, err = g.getter.Get(ctx, key)
+	}
 	if err != nil {
+		g.stats.localLoadErrs.Add(1)
+		g.log().Debug("failed to load locally", "group", g.name, "key", key,
+			"latency", time.Since(start), "err", err)
+		if value, ok := g.notFoundView(); ok && errors.Is(err, ErrNotFound) {
+			g.populateCache(key, value, &g.mainCache)
+		}
 		return ByteView{}, err
 	}
+	g.stats.localLoads.Add(1)
+	g.log().Debug("load locally", "group", g.name, "key", key, "latency", time.Since(start))
 
-	value := ByteView{b: bytes}
-	g.populateCache(key, value)
+	value := ByteView{b: bytes, e: expire}
+	g.populateCache(key, value, &g.mainCache)
 	return value, nil
 }
 
-// populateCache adds the new key-value in the cache
-func (g *Group) populateCache(key string, value ByteView) {
-	g.mainCache.add(key, value)
+// notFoundView builds the negative entry which expires after the negativeTTL,
+// ok is false if the negative caching is disabled
+func (g *Group) notFoundView() (value ByteView, ok bool) {
+	if g.negativeTTL <= 0 {
+		return ByteView{}, false
+	}
+	return ByteView{e: time.Now().Add(g.negativeTTL), notFound: true}, true
+}
+
+// populateCache adds the new key-value in the mainCache or the hotCache
+func (g *Group) populateCache(key string, value ByteView, cache *shardedCache) {
+	cache.add(key, value)
+}
+
+// janitor reclaims the bytes of the expired entries periodically
+func (g *Group) janitor() {
+	ticker := time.NewTicker(g.janitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.mainCache.removeExpired()
+			g.hotCache.removeExpired()
+		case <-g.done:
+			return
+		}
+	}
+}
+
+// Close stops the janitor and removes the group from the groups if it's still there,
+// the group can still be used, the expired entries are treated as misses without the janitor
+func (g *Group) Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	if groups[g.name] == g {
+		delete(groups, g.name)
+	}
+	g.stop()
+}
+
+// stop closes the done channel once
+func (g *Group) stop() {
+	g.closeOnce.Do(func() {
+		close(g.done)
+	})
 }
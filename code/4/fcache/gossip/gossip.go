@@ -0,0 +1,516 @@
+package gossip
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProbeInterval    = time.Second
+	defaultProbeTimeout     = 500 * time.Millisecond
+	defaultSuspicionTimeout = 5 * time.Second
+	defaultIndirectChecks   = 3
+	// maxPacketSize the largest UDP packet
+	maxPacketSize = 65536
+)
+
+// State is the state of a member
+type State int
+
+const (
+	// Alive the member answers the probes
+	Alive State = iota
+	// Suspect the member failed a probe, it's declared dead if it doesn't refute in time
+	Suspect
+	// Dead the member failed or left
+	Dead
+)
+
+func (s State) String() string {
+	switch s {
+	case Alive:
+		return "alive"
+	case Suspect:
+		return "suspect"
+	case Dead:
+		return "dead"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Member is a node of the cluster
+type Member struct {
+	// Name identifies the member, e.g. the HTTP address of the peer http://localhost:8001
+	Name string `json:"name"`
+	// Addr is the UDP address of the member
+	Addr  string `json:"addr"`
+	State State  `json:"state"`
+	// Incarnation is only increased by the member itself to refute the suspicion,
+	// the update with the higher incarnation wins
+	Incarnation uint64 `json:"incarnation"`
+}
+
+// newer reports whether the update u overrides the known state cur
+// the higher incarnation wins, and Dead > Suspect > Alive in the same incarnation
+func newer(u, cur Member) bool {
+	return u.Incarnation > cur.Incarnation || (u.Incarnation == cur.Incarnation && u.State > cur.State)
+}
+
+// PeerSetter is updated as the members join, leave or are suspected,
+// e.g. fcache.HttpPool
+type PeerSetter interface {
+	AddPeers(peers ...string)
+	RemovePeers(peers ...string)
+}
+
+// Config are the configurations of a Memberlist
+type Config struct {
+	// Name is announced to the other members and set to the Peers
+	Name string
+	// BindAddr is the UDP address to listen, e.g. 127.0.0.1:7946
+	BindAddr string
+	// AdvertiseAddr is the UDP address announced to the other members,
+	// the address of the listener is used if it's empty
+	AdvertiseAddr string
+	// Peers is updated with the alive members including this one, optional
+	Peers PeerSetter
+	// ProbeInterval specifies how often a member is probed, defaultProbeInterval is used if it's zero
+	ProbeInterval time.Duration
+	// ProbeTimeout specifies how long to wait the ack of the direct probe before the indirect probes,
+	// defaultProbeTimeout is used if it's zero
+	ProbeTimeout time.Duration
+	// SuspicionTimeout specifies how long a suspect member is declared dead after,
+	// defaultSuspicionTimeout is used if it's zero
+	SuspicionTimeout time.Duration
+	// IndirectChecks specifies how many members are asked to probe for the failed direct probe,
+	// defaultIndirectChecks is used if it's zero
+	IndirectChecks int
+	// Logger is slog.Default() if it's nil
+	Logger *slog.Logger
+}
+
+// Memberlist keeps the members of the cluster in the style of SWIM:
+// a random member is probed every ProbeInterval, directly and then indirectly by the other members,
+// the member which fails is suspected and declared dead later,
+// the updates are disseminated by piggybacking them on the probes
+type Memberlist struct {
+	config Config
+	conn   *net.UDPConn
+
+	mu sync.Mutex
+	// all known members including this one by the name, the dead ones are kept
+	// so that their old updates are ignored
+	members map[string]*Member
+	// the timers declaring the suspect members dead
+	suspects map[string]*time.Timer
+	queue    []*broadcast
+	// the ack handlers by the sequence number
+	pending map[uint64]func()
+	seq     uint64
+	// the members to probe in a round, shuffled every round
+	probeList []string
+	leaving   bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// New starts listening on the BindAddr and probing the members,
+// this member is added to the Peers at once
+func New(c Config) (*Memberlist, error) {
+	if c.ProbeInterval == 0 {
+		c.ProbeInterval = defaultProbeInterval
+	}
+	if c.ProbeTimeout == 0 {
+		c.ProbeTimeout = defaultProbeTimeout
+	}
+	if c.SuspicionTimeout == 0 {
+		c.SuspicionTimeout = defaultSuspicionTimeout
+	}
+	if c.IndirectChecks == 0 {
+		c.IndirectChecks = defaultIndirectChecks
+	}
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+	addr, err := net.ResolveUDPAddr("udp", c.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if c.AdvertiseAddr == "" {
+		c.AdvertiseAddr = conn.LocalAddr().String()
+	}
+
+	l := &Memberlist{
+		config:   c,
+		conn:     conn,
+		members:  make(map[string]*Member),
+		suspects: make(map[string]*time.Timer),
+		pending:  make(map[uint64]func()),
+		stop:     make(chan struct{}),
+	}
+	// the incarnation starts from the start time, so a restarted member overrides its old state
+	l.members[c.Name] = &Member{Name: c.Name, Addr: c.AdvertiseAddr, State: Alive, Incarnation: uint64(time.Now().UnixNano())}
+	if c.Peers != nil {
+		c.Peers.AddPeers(c.Name)
+	}
+	go l.listen()
+	go l.probeLoop()
+	return l, nil
+}
+
+// Addr returns the UDP address announced to the other members
+func (l *Memberlist) Addr() string {
+	return l.config.AdvertiseAddr
+}
+
+// Members returns the members which aren't dead, including this one
+func (l *Memberlist) Members() []Member {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	members := make([]Member, 0, len(l.members))
+	for _, m := range l.members {
+		if m.State != Dead {
+			members = append(members, *m)
+		}
+	}
+	return members
+}
+
+// Join contacts the seeds by their UDP addresses and learns all the members they know,
+// it returns an error if no seed answers
+func (l *Memberlist) Join(seeds ...string) error {
+	joined := 0
+	for _, seed := range seeds {
+		acked := make(chan struct{}, 1)
+		seq := l.addPending(func() { acked <- struct{}{} })
+		l.send(seed, message{Type: joinMsg, Seq: seq, Updates: []Member{l.self()}})
+		select {
+		case <-acked:
+			joined++
+		case <-time.After(l.config.ProbeInterval):
+			l.removePending(seq)
+			l.config.Logger.Warn("failed to join the seed", "name", l.config.Name, "seed", seed)
+		}
+	}
+	if joined == 0 {
+		return fmt.Errorf("failed to join any seed of %v", seeds)
+	}
+	return nil
+}
+
+// Leave tells the members this one is leaving and shuts it down
+func (l *Memberlist) Leave() error {
+	l.mu.Lock()
+	l.leaving = true
+	self := l.members[l.config.Name]
+	self.State = Dead
+	left := *self
+	var addrs []string
+	for _, m := range l.members {
+		if m.Name != l.config.Name && m.State != Dead {
+			addrs = append(addrs, m.Addr)
+		}
+	}
+	l.mu.Unlock()
+
+	for _, addr := range addrs {
+		l.send(addr, message{Type: pingMsg, Seq: l.addPending(nil), Updates: []Member{left}})
+	}
+	return l.Shutdown()
+}
+
+// Shutdown stops probing and closes the listener without telling the other members
+func (l *Memberlist) Shutdown() error {
+	var err error
+	l.stopOnce.Do(func() {
+		close(l.stop)
+		err = l.conn.Close()
+		l.mu.Lock()
+		for _, t := range l.suspects {
+			t.Stop()
+		}
+		l.mu.Unlock()
+	})
+	return err
+}
+
+// self returns the state of this member
+func (l *Memberlist) self() Member {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return *l.members[l.config.Name]
+}
+
+// addPending registers the ack handler and returns its sequence number
+func (l *Memberlist) addPending(fn func()) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	if fn != nil {
+		l.pending[l.seq] = fn
+	}
+	return l.seq
+}
+
+func (l *Memberlist) removePending(seq uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.pending, seq)
+}
+
+// send writes the message to the UDP address with the piggybacked updates
+func (l *Memberlist) send(addr string, msg message) {
+	msg.Updates = append(msg.Updates, l.piggyback()...)
+	b, err := json.Marshal(msg)
+	if err != nil {
+		l.config.Logger.Error("failed to marshal the message", "name", l.config.Name, "err", err)
+		return
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		l.config.Logger.Warn("failed to resolve the member", "name", l.config.Name, "addr", addr, "err", err)
+		return
+	}
+	if _, err := l.conn.WriteToUDP(b, udpAddr); err != nil {
+		l.config.Logger.Debug("failed to send the message", "name", l.config.Name, "addr", addr, "err", err)
+	}
+}
+
+// listen reads the messages until the listener is closed
+func (l *Memberlist) listen() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-l.stop:
+				return
+			default:
+				continue
+			}
+		}
+		var msg message
+		if err := json.Unmarshal(buf[:n], &msg); err != nil {
+			l.config.Logger.Warn("failed to unmarshal the message", "name", l.config.Name, "from", from, "err", err)
+			continue
+		}
+		l.handle(msg, from.String())
+	}
+}
+
+// handle merges the piggybacked updates and answers the message
+func (l *Memberlist) handle(msg message, from string) {
+	l.mu.Lock()
+	for _, u := range msg.Updates {
+		l.apply(u)
+	}
+	l.mu.Unlock()
+
+	switch msg.Type {
+	case pingMsg:
+		l.send(from, message{Type: ackMsg, Seq: msg.Seq})
+	case joinMsg:
+		l.mu.Lock()
+		members := make([]Member, 0, len(l.members))
+		for _, m := range l.members {
+			members = append(members, *m)
+		}
+		l.mu.Unlock()
+		l.send(from, message{Type: ackMsg, Seq: msg.Seq, Updates: members})
+	case pingReqMsg:
+		// forward the ack of the target to the sender with its sequence number
+		seq := l.addPending(func() {
+			l.send(from, message{Type: ackMsg, Seq: msg.Seq})
+		})
+		time.AfterFunc(l.config.ProbeInterval, func() { l.removePending(seq) })
+		l.send(msg.Target, message{Type: pingMsg, Seq: seq})
+	case ackMsg:
+		l.mu.Lock()
+		fn := l.pending[msg.Seq]
+		delete(l.pending, msg.Seq)
+		l.mu.Unlock()
+		if fn != nil {
+			fn()
+		}
+	}
+}
+
+// apply merges the update of a member, it must be called with l.mu held
+func (l *Memberlist) apply(u Member) {
+	if u.Name == l.config.Name {
+		self := l.members[l.config.Name]
+		// the others think this member is suspect or dead, refute it with a higher incarnation
+		if u.State != Alive && !l.leaving && u.Incarnation >= self.Incarnation {
+			self.Incarnation = u.Incarnation + 1
+			l.enqueue(*self)
+		}
+		return
+	}
+
+	cur, ok := l.members[u.Name]
+	if !ok {
+		if u.State == Dead {
+			return
+		}
+		cur = &Member{Name: u.Name, State: Dead}
+		l.members[u.Name] = cur
+	} else if !newer(u, *cur) {
+		return
+	}
+	old := cur.State
+	*cur = u
+	l.enqueue(u)
+	l.changed(u, old)
+}
+
+// changed updates the Peers and the suspicion timers when the state of a member changes,
+// it must be called with l.mu held
+func (l *Memberlist) changed(m Member, old State) {
+	if m.State != Suspect {
+		if t, ok := l.suspects[m.Name]; ok {
+			t.Stop()
+			delete(l.suspects, m.Name)
+		}
+	}
+	if m.State == old {
+		return
+	}
+	l.config.Logger.Info("member changed", "name", l.config.Name, "member", m.Name, "from", old, "to", m.State)
+
+	switch m.State {
+	case Alive:
+		if l.config.Peers != nil {
+			l.config.Peers.AddPeers(m.Name)
+		}
+	case Suspect:
+		if l.config.Peers != nil && old == Alive {
+			l.config.Peers.RemovePeers(m.Name)
+		}
+		l.suspects[m.Name] = time.AfterFunc(l.config.SuspicionTimeout, func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if cur := l.members[m.Name]; cur.State == Suspect && cur.Incarnation == m.Incarnation {
+				dead := *cur
+				dead.State = Dead
+				l.apply(dead)
+			}
+		})
+	case Dead:
+		if l.config.Peers != nil && old == Alive {
+			l.config.Peers.RemovePeers(m.Name)
+		}
+	}
+}
+
+// probeLoop probes a member every ProbeInterval until shutdown
+func (l *Memberlist) probeLoop() {
+	ticker := time.NewTicker(l.config.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if target, ok := l.nextTarget(); ok {
+				l.probe(target)
+			}
+		}
+	}
+}
+
+// nextTarget returns the next member to probe in the round,
+// every member which isn't dead is probed once in a round
+func (l *Memberlist) nextTarget() (Member, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for {
+		if len(l.probeList) == 0 {
+			for name, m := range l.members {
+				if name != l.config.Name && m.State != Dead {
+					l.probeList = append(l.probeList, name)
+				}
+			}
+			if len(l.probeList) == 0 {
+				return Member{}, false
+			}
+			rand.Shuffle(len(l.probeList), func(i, j int) {
+				l.probeList[i], l.probeList[j] = l.probeList[j], l.probeList[i]
+			})
+		}
+		name := l.probeList[0]
+		l.probeList = l.probeList[1:]
+		if m := l.members[name]; m.State != Dead {
+			return *m, true
+		}
+	}
+}
+
+// probe pings the target directly, and then asks IndirectChecks members to ping it,
+// the target is suspected if no ack comes back in the ProbeInterval
+func (l *Memberlist) probe(target Member) {
+	acked := make(chan struct{}, 1)
+	seq := l.addPending(func() {
+		select {
+		case acked <- struct{}{}:
+		default:
+		}
+	})
+	defer l.removePending(seq)
+
+	start := time.Now()
+	l.send(target.Addr, message{Type: pingMsg, Seq: seq})
+	select {
+	case <-acked:
+		return
+	case <-l.stop:
+		return
+	case <-time.After(l.config.ProbeTimeout):
+	}
+
+	for _, addr := range l.helpers(target.Name) {
+		l.send(addr, message{Type: pingReqMsg, Seq: seq, Target: target.Addr})
+	}
+	select {
+	case <-acked:
+		// the ack is forwarded by a helper
+		return
+	case <-l.stop:
+		return
+	case <-time.After(l.config.ProbeInterval - time.Since(start)):
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	suspect := target
+	if cur := l.members[target.Name]; cur != nil {
+		suspect = *cur
+	}
+	if suspect.State == Alive {
+		suspect.State = Suspect
+		l.apply(suspect)
+	}
+}
+
+// helpers picks IndirectChecks random members to ping the target
+func (l *Memberlist) helpers(target string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var addrs []string
+	for name, m := range l.members {
+		if name != l.config.Name && name != target && m.State == Alive {
+			addrs = append(addrs, m.Addr)
+		}
+	}
+	rand.Shuffle(len(addrs), func(i, j int) { addrs[i], addrs[j] = addrs[j], addrs[i] })
+	return addrs[:min(len(addrs), l.config.IndirectChecks)]
+}
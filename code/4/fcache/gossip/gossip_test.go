@@ -0,0 +1,135 @@
+package gossip
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePeers records the peers set by the Memberlist
+type fakePeers struct {
+	mu    sync.Mutex
+	peers map[string]struct{}
+}
+
+func (p *fakePeers) AddPeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, peer := range peers {
+		p.peers[peer] = struct{}{}
+	}
+}
+
+func (p *fakePeers) RemovePeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, peer := range peers {
+		delete(p.peers, peer)
+	}
+}
+
+func (p *fakePeers) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, 0, len(p.peers))
+	for peer := range p.peers {
+		names = append(names, peer)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// startNodes starts n members on localhost and joins them to the first one
+func startNodes(t *testing.T, n int) ([]*Memberlist, []*fakePeers) {
+	lists := make([]*Memberlist, n)
+	peers := make([]*fakePeers, n)
+	for i := 0; i < n; i++ {
+		peers[i] = &fakePeers{peers: make(map[string]struct{})}
+		l, err := New(Config{
+			Name:             fmt.Sprintf("node%d", i),
+			BindAddr:         "127.0.0.1:0",
+			Peers:            peers[i],
+			ProbeInterval:    20 * time.Millisecond,
+			ProbeTimeout:     10 * time.Millisecond,
+			SuspicionTimeout: 100 * time.Millisecond,
+			Logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.Shutdown() })
+		lists[i] = l
+		if i > 0 {
+			if err := l.Join(lists[0].Addr()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return lists, peers
+}
+
+// waitPeers waits until all the fakePeers are the expected peers
+func waitPeers(t *testing.T, peers []*fakePeers, expect string) {
+	deadline := time.Now().Add(3 * time.Second)
+	for _, p := range peers {
+		for p.String() != expect {
+			if time.Now().After(deadline) {
+				t.Fatalf("expect peers %s, but %s got", expect, p.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	lists, peers := startNodes(t, 3)
+	waitPeers(t, peers, "node0,node1,node2")
+	for _, l := range lists {
+		if len(l.Members()) != 3 {
+			t.Fatalf("every member should know the others, but %v got", l.Members())
+		}
+	}
+}
+
+func TestFailureDetection(t *testing.T) {
+	lists, peers := startNodes(t, 3)
+	waitPeers(t, peers, "node0,node1,node2")
+
+	// node2 stops answering without telling the others
+	lists[2].Shutdown()
+	waitPeers(t, peers[:2], "node0,node1")
+}
+
+func TestLeave(t *testing.T) {
+	lists, peers := startNodes(t, 3)
+	waitPeers(t, peers, "node0,node1,node2")
+
+	if err := lists[1].Leave(); err != nil {
+		t.Fatal(err)
+	}
+	waitPeers(t, []*fakePeers{peers[0], peers[2]}, "node0,node2")
+}
+
+func TestRefute(t *testing.T) {
+	lists, peers := startNodes(t, 2)
+	waitPeers(t, peers, "node0,node1")
+
+	// node0 suspects node1 by mistake, node1 refutes it with a higher incarnation
+	lists[0].mu.Lock()
+	suspect := *lists[0].members["node1"]
+	suspect.State = Suspect
+	lists[0].apply(suspect)
+	lists[0].mu.Unlock()
+	if peers[0].String() != "node0" {
+		t.Fatalf("the suspect member should be removed from the peers, but %s got", peers[0].String())
+	}
+	waitPeers(t, peers, "node0,node1")
+	if self := lists[1].self(); self.Incarnation <= suspect.Incarnation {
+		t.Fatal("the incarnation should be increased to refute the suspicion")
+	}
+}
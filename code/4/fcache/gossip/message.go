@@ -0,0 +1,85 @@
+package gossip
+
+import (
+	"sort"
+)
+
+const (
+	// maxPiggyback the most updates piggybacked on a message
+	maxPiggyback = 8
+	// retransmitMult an update is piggybacked retransmitMult * log2(n+1) times, n is the number of members
+	retransmitMult = 4
+)
+
+// msgType is the type of the message between the members
+type msgType int
+
+const (
+	// pingMsg asks the receiver to ack directly
+	pingMsg msgType = iota
+	// pingReqMsg asks the receiver to ping the target and forward the ack
+	pingReqMsg
+	// ackMsg answers the ping, the pingReq and the join
+	ackMsg
+	// joinMsg asks the seed to ack with all the members it knows
+	joinMsg
+)
+
+// message is sent in one UDP packet, the updates are piggybacked on every message
+type message struct {
+	Type msgType `json:"type"`
+	Seq  uint64  `json:"seq"`
+	// Target is the UDP address to ping for a pingReq
+	Target  string   `json:"target,omitempty"`
+	Updates []Member `json:"updates,omitempty"`
+}
+
+// broadcast is an update waiting to be piggybacked
+type broadcast struct {
+	m         Member
+	transmits int
+}
+
+// enqueue puts the update in the queue, the older update of the same member is replaced,
+// it must be called with l.mu held
+func (l *Memberlist) enqueue(m Member) {
+	for _, b := range l.queue {
+		if b.m.Name == m.Name {
+			b.m = m
+			b.transmits = 0
+			return
+		}
+	}
+	l.queue = append(l.queue, &broadcast{m: m})
+}
+
+// piggyback takes the updates transmitted the least times,
+// the updates transmitted enough times are dropped from the queue
+func (l *Memberlist) piggyback() []Member {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.queue) == 0 {
+		return nil
+	}
+
+	limit := 0
+	for n := len(l.members); n > 0; n >>= 1 {
+		limit += retransmitMult
+	}
+	sort.SliceStable(l.queue, func(i, j int) bool {
+		return l.queue[i].transmits < l.queue[j].transmits
+	})
+	updates := make([]Member, 0, min(len(l.queue), maxPiggyback))
+	for _, b := range l.queue[:min(len(l.queue), maxPiggyback)] {
+		updates = append(updates, b.m)
+		b.transmits++
+	}
+	kept := l.queue[:0]
+	for _, b := range l.queue {
+		if b.transmits < limit {
+			kept = append(kept, b)
+		}
+	}
+	l.queue = kept
+	return updates
+}
@@ -1,9 +1,19 @@
 package fcache
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	pb "github.com/univero/fcache/fcache/cachepb"
+	"github.com/univero/fcache/fcache/lru"
 	"log"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // Simulate a time-consuming db with map
@@ -27,16 +37,572 @@ func TestGet(t *testing.T) {
 			}
 			return nil, fmt.Errorf("key %s not found", key)
 		}))
+	defer fcache.Close()
 	for k, v := range db {
-		if view, err := fcache.Get(k); err != nil || view.String() != v {
+		if view, err := fcache.Get(context.Background(), k); err != nil || view.String() != v {
 			t.Fatal("failed to get the key:", k)
 		}
-		if _, err := fcache.Get(k); err != nil || loadCounts[k] > 1 {
+		if _, err := fcache.Get(context.Background(), k); err != nil || loadCounts[k] > 1 {
 			t.Fatal("failed to get the key:", k)
 		}
 	}
 
-	if view, err := fcache.Get("unknown"); err == nil {
+	if view, err := fcache.Get(context.Background(), "unknown"); err == nil {
 		t.Fatalf("the value of unknow should be empty, but %s got", view)
 	}
 }
+
+func TestGroupPolicy(t *testing.T) {
+	g := NewGroup("policy", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithPolicy(lru.ARC))
+	defer g.Close()
+	if _, ok := g.mainCache.shards[0].lru.(*lru.ARCCache); ok {
+		t.Fatal("the cache should be created lazily")
+	}
+	if view, err := g.Get(context.Background(), "Tom"); err != nil || view.String() != "Tom" {
+		t.Fatal("failed to get the key: Tom")
+	}
+	if _, ok := g.mainCache.shards[0].lru.(*lru.ARCCache); !ok {
+		t.Fatal("the policy of the cache should be ARC")
+	}
+}
+
+func TestGetExpire(t *testing.T) {
+	loads := 0
+	g := NewGroup("expire", 2<<10, ExpireGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Time, error) {
+			loads++
+			return []byte(key), time.Now().Add(20 * time.Millisecond), nil
+		}), WithJanitor(10*time.Millisecond))
+	defer g.Close()
+	if _, err := g.Get(context.Background(), "Tom"); err != nil || loads != 1 {
+		t.Fatal("failed to get the key: Tom")
+	}
+	if _, err := g.Get(context.Background(), "Tom"); err != nil || loads != 1 {
+		t.Fatal("Tom should be cached before it expires")
+	}
+	time.Sleep(50 * time.Millisecond)
+	c := &g.mainCache.shards[0]
+	c.mu.Lock()
+	n := c.lru.Len()
+	c.mu.Unlock()
+	if n != 0 {
+		t.Fatal("the expired Tom should be reclaimed by the janitor")
+	}
+	if _, err := g.Get(context.Background(), "Tom"); err != nil || loads != 2 {
+		t.Fatal("the expired Tom should be loaded again")
+	}
+}
+
+func TestClose(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	old := NewGroup("close", 2<<10, getter)
+	g := NewGroup("close", 2<<10, getter)
+	select {
+	case <-old.done:
+	default:
+		t.Fatal("the janitor of the replaced group should be stopped")
+	}
+
+	g.Close()
+	if GetGroup("close") != nil {
+		t.Fatal("the closed group should be removed from the groups")
+	}
+	if view, err := g.Get(context.Background(), "Tom"); err != nil || view.String() != "Tom" {
+		t.Fatal("the closed group should still be usable")
+	}
+	g.Close()
+}
+
+func TestSet(t *testing.T) {
+	g := NewGroup("set", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("key %s not found", key)
+		}))
+	defer g.Close()
+	if err := g.Set("Tom", []byte("630"), time.Time{}); err != nil {
+		t.Fatal("failed to set the key: Tom")
+	}
+	if view, err := g.Get(context.Background(), "Tom"); err != nil || view.String() != "630" {
+		t.Fatal("failed to get the key set before: Tom")
+	}
+	if err := g.Set("Sam", []byte("567"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal("failed to set the key: Sam")
+	}
+	if _, err := g.Get(context.Background(), "Sam"); err == nil {
+		t.Fatal("the expired Sam should be a miss")
+	}
+}
+
+func TestGroupShards(t *testing.T) {
+	g := NewGroup("shards", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithShards(4))
+	defer g.Close()
+	if len(g.mainCache.shards) != 4 {
+		t.Fatalf("expect 4 shards, but %d got", len(g.mainCache.shards))
+	}
+	for k := range db {
+		if view, err := g.Get(context.Background(), k); err != nil || view.String() != k {
+			t.Fatal("failed to get the key:", k)
+		}
+	}
+}
+
+// fakePeer returns the key as the value and counts the calls
+type fakePeer struct {
+	mu         sync.Mutex
+	calls      int
+	batchCalls int
+	removed    []string
+	// the down peer fails all gets
+	down bool
+	// the peer answers that every key isn't found
+	notFound bool
+}
+
+func (p *fakePeer) String() string {
+	return "fake"
+}
+
+func (p *fakePeer) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.calls++
+	if p.down {
+		return errors.New("peer is down")
+	}
+	if p.notFound {
+		out.NotFound = true
+		return nil
+	}
+	out.Value = []byte(in.GetKey())
+	return nil
+}
+
+func (p *fakePeer) Remove(ctx context.Context, in *pb.Request) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removed = append(p.removed, in.GetKey())
+	return nil
+}
+
+func (p *fakePeer) GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.batchCalls++
+	for _, key := range in.GetKeys() {
+		out.Values = append(out.Values, &pb.KeyValue{Key: key, Value: []byte(key)})
+	}
+	return nil
+}
+
+// fakePicker picks the fakePeer for every key
+type fakePicker struct {
+	peer   *fakePeer
+	others []*fakePeer
+}
+
+func (p *fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	return p.peer, true
+}
+
+func (p *fakePicker) GetAll() []PeerGetter {
+	getters := []PeerGetter{p.peer}
+	for _, peer := range p.others {
+		getters = append(getters, peer)
+	}
+	return getters
+}
+
+func TestHotCache(t *testing.T) {
+	g := NewGroup("hot", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("key %s should be loaded from peer", key)
+		}))
+	defer g.Close()
+	peer := &fakePeer{}
+	g.RegisterPeers(&fakePicker{peer: peer})
+	for i := 0; i < 200; i++ {
+		if view, err := g.Get(context.Background(), "Tom"); err != nil || view.String() != "Tom" {
+			t.Fatal("failed to get the key: Tom")
+		}
+	}
+	if peer.calls >= 200 {
+		t.Fatal("Tom should be sampled into the hotCache")
+	}
+	if _, ok := g.hotCache.get("Tom"); !ok {
+		t.Fatal("Tom should be in the hotCache")
+	}
+	if _, ok := g.mainCache.get("Tom"); ok {
+		t.Fatal("Tom owned by the peer shouldn't be in the mainCache")
+	}
+	if g.hotCache.shards[0].cacheBytes+g.mainCache.shards[0].cacheBytes != 2<<10 {
+		t.Fatal("the hotCache bytes should be split from the cacheBytes")
+	}
+}
+
+func TestHotCacheBytes(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	g := NewGroup("hot-standalone", 2<<10, getter)
+	defer g.Close()
+	if g.hotCacheEnabled.Load() || g.mainCache.shards[0].cacheBytes != 2<<10 {
+		t.Fatal("the standalone group should give all bytes to the mainCache")
+	}
+	g.RegisterPeers(&fakePicker{peer: &fakePeer{}})
+	if !g.hotCacheEnabled.Load() || g.mainCache.shards[0].cacheBytes != 2<<10-(2<<10)/defaultHotCacheDivisor {
+		t.Fatalf("the hotCache should take 1/%d of the bytes with the peers", defaultHotCacheDivisor)
+	}
+
+	g = NewGroup("hot-set", 2<<10, getter, WithHotCacheBytes(100))
+	defer g.Close()
+	g.RegisterPeers(&fakePicker{peer: &fakePeer{}})
+	if g.hotCacheBytes != 100 || g.mainCache.shards[0].cacheBytes != 2<<10-100 {
+		t.Fatal("the hotCache bytes set by the option should be kept")
+	}
+}
+
+func TestRegisterPeersKeepsEntries(t *testing.T) {
+	g := NewGroup("hot-keep", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("db"), nil
+		}))
+	defer g.Close()
+	if err := g.Set("Tom", []byte("630"), time.Time{}); err != nil {
+		t.Fatal("failed to set the key: Tom")
+	}
+	g.RegisterPeers(&fakePicker{peer: &fakePeer{}})
+	if view, err := g.Get(context.Background(), "Tom"); err != nil || view.String() != "630" {
+		t.Fatal("the entries cached before RegisterPeers should be kept")
+	}
+}
+
+func TestRegisterPeersWithJanitor(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	for i := 0; i < 20; i++ {
+		g := NewGroup(fmt.Sprintf("hot-janitor-%d", i), 2<<10, getter, WithJanitor(time.Microsecond))
+		time.Sleep(time.Duration(i) * time.Microsecond)
+		g.RegisterPeers(&fakePicker{peer: &fakePeer{}})
+		_ = g.CacheStats(MainCache)
+		g.Close()
+	}
+}
+
+func TestRemove(t *testing.T) {
+	g := NewGroup("remove", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	defer g.Close()
+	owner, other := &fakePeer{}, &fakePeer{}
+	g.RegisterPeers(&fakePicker{peer: owner, others: []*fakePeer{other}})
+	if err := g.Set("Tom", []byte("630"), time.Time{}); err != nil {
+		t.Fatal("failed to set the key: Tom")
+	}
+	if err := g.Remove(context.Background(), "Tom"); err != nil {
+		t.Fatal("failed to remove the key: Tom")
+	}
+	if _, ok := g.mainCache.get("Tom"); ok {
+		t.Fatal("Tom should be removed locally")
+	}
+	if len(owner.removed) != 1 || len(other.removed) != 1 {
+		t.Fatal("the removal should be sent to the owner and broadcast to the others once")
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	g := NewGroup("context", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Second):
+				return []byte(key), nil
+			}
+		}))
+	defer g.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := g.Get(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("the load should be cancelled by the deadline, but %v got", err)
+	}
+}
+
+// slowPeer answers the gets after the delay
+type slowPeer struct {
+	fakePeer
+	delay time.Duration
+}
+
+func (p *slowPeer) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	time.Sleep(p.delay)
+	out.Value = []byte(in.GetKey())
+	return nil
+}
+
+// slowPicker picks the slowPeer for every key
+type slowPicker struct {
+	fakePicker
+	peer *slowPeer
+}
+
+func (p *slowPicker) PickPeer(key string) (PeerGetter, bool) {
+	return p.peer, true
+}
+
+func TestLoadCallerCancel(t *testing.T) {
+	g := NewGroup("caller-cancel", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("key %s should be loaded from the peer", key)
+		}))
+	defer g.Close()
+	g.RegisterPeers(&slowPicker{peer: &slowPeer{delay: 50 * time.Millisecond}})
+
+	// the first caller goes away while the second one keeps the load running
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := g.Get(ctx, "Tom")
+		first <- err
+	}()
+	second := make(chan ByteView)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		view, err := g.Get(context.Background(), "Tom")
+		if err != nil {
+			t.Error(err)
+		}
+		second <- view
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("the first caller should be cancelled, but %v got", err)
+	}
+	if view := <-second; view.String() != "Tom" {
+		t.Fatalf("the second caller should get the value of the load, but %s got", view.String())
+	}
+}
+
+func TestStats(t *testing.T) {
+	g := NewGroup("stats", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("key %s not found", key)
+		}))
+	defer g.Close()
+	for k := range db {
+		g.Get(context.Background(), k)
+		g.Get(context.Background(), k)
+	}
+	g.Get(context.Background(), "unknown")
+	expect := Stats{Gets: 7, CacheHits: 3, LocalLoads: 3, LocalLoadErrs: 1}
+	if s := g.Stats(); s != expect {
+		t.Fatalf("expect stats %+v, but %+v got", expect, s)
+	}
+	cs := g.CacheStats(MainCache)
+	if cs.Items != 3 || cs.Gets != 7 || cs.Hits != 3 || cs.Bytes != int64(len("TomJackSam"+"630589567")) {
+		t.Fatalf("unexpected main cache stats %+v", cs)
+	}
+}
+
+func TestLoadsDeduped(t *testing.T) {
+	release := make(chan struct{})
+	g := NewGroup("deduped", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			<-release
+			return []byte(key), nil
+		}))
+	defer g.Close()
+
+	const n = 5
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Get(context.Background(), "Tom")
+		}()
+	}
+	// all callers join the load before it's done
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if s := g.Stats(); s.LocalLoads != 1 || s.LoadsDeduped != n-1 {
+		t.Fatalf("expect 1 load and %d deduped loads, but %d and %d got", n-1, s.LocalLoads, s.LoadsDeduped)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	g := NewGroup("logger", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}), WithLogger(logger))
+	defer g.Close()
+	g.Get(context.Background(), "Tom")
+	g.Get(context.Background(), "Tom")
+
+	out := buf.String()
+	for _, s := range []string{"load locally", "cache hit", "group=logger", "key=Tom", "latency="} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("the log should contain %q, but %q got", s, out)
+		}
+	}
+	if strings.Contains(out, db["Tom"]) {
+		t.Fatalf("the value shouldn't be logged, but %q got", out)
+	}
+
+	// the peer is logged as well
+	buf.Reset()
+	g.RegisterPeers(&fakePicker{peer: &fakePeer{down: true}})
+	g.Get(context.Background(), "Jack")
+	g.GetMany(context.Background(), []string{"Sam"})
+	out = buf.String()
+	for _, s := range []string{"failed to get from peer", "load many from peer", "peer=fake"} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("the log should contain %q, but %q got", s, out)
+		}
+	}
+}
+
+func TestGetterPanic(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	g := NewGroup("panic", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			panic("boom")
+		}), WithLogger(logger))
+	defer g.Close()
+	_, err := g.Get(context.Background(), "Tom")
+	if err == nil || err.Error() != "panic: boom" {
+		t.Fatalf("only the panic value should be in the error, but %v got", err)
+	}
+	if !strings.Contains(buf.String(), "load panicked") || !strings.Contains(buf.String(), "fcache.go") {
+		t.Fatalf("the stack of the panic should be logged, but %q got", buf.String())
+	}
+}
+
+// fakeReplicaPicker picks the replicas in order for every key
+type fakeReplicaPicker struct {
+	fakePicker
+	replicas []*fakePeer
+	self     bool
+}
+
+func (p *fakeReplicaPicker) PickPeers(key string, n int) ([]PeerGetter, bool) {
+	var getters []PeerGetter
+	for _, peer := range p.replicas[:min(n, len(p.replicas))] {
+		getters = append(getters, peer)
+	}
+	return getters, p.self
+}
+
+func TestReplication(t *testing.T) {
+	g := NewGroup("replication", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("key %s should be loaded from the replicas", key)
+		}), WithReplication(2), WithHotCacheBytes(0))
+	defer g.Close()
+	primary, secondary := &fakePeer{down: true}, &fakePeer{}
+	g.RegisterPeers(&fakeReplicaPicker{fakePicker: fakePicker{peer: primary}, replicas: []*fakePeer{primary, secondary}})
+	if view, err := g.Get(context.Background(), "Tom"); err != nil || view.String() != "Tom" {
+		t.Fatalf("failed to get the key from the secondary: %v", err)
+	}
+	if primary.calls != 1 || secondary.calls != 1 {
+		t.Fatal("the primary should be tried before the secondary")
+	}
+	if _, ok := g.mainCache.get("Tom"); ok {
+		t.Fatal("Tom isn't owned by this peer, it shouldn't be in the mainCache")
+	}
+}
+
+func TestReplicaMainCache(t *testing.T) {
+	g := NewGroup("replica", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("key %s should be loaded from the primary", key)
+		}), WithReplication(2))
+	defer g.Close()
+	primary := &fakePeer{}
+	g.RegisterPeers(&fakeReplicaPicker{fakePicker: fakePicker{peer: primary}, replicas: []*fakePeer{primary}, self: true})
+	if _, err := g.Get(context.Background(), "Tom"); err != nil {
+		t.Fatalf("failed to get the key from the primary: %v", err)
+	}
+	if _, ok := g.mainCache.get("Tom"); !ok {
+		t.Fatal("this peer is a replica of Tom, it should keep Tom in the mainCache")
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	var loads atomic.Int32
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		return nil, fmt.Errorf("key %s: %w", key, ErrNotFound)
+	})
+	g := NewGroup("negative", 2<<10, getter, WithNegativeCache(20*time.Millisecond))
+	defer g.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := g.Get(context.Background(), "unknown"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("the not found error should be returned, but %v got", err)
+		}
+	}
+	if loads.Load() != 1 {
+		t.Fatalf("the key not found should be cached, but it's loaded %d times", loads.Load())
+	}
+	if _, err := g.GetMany(context.Background(), []string{"unknown"}); !errors.Is(err, ErrNotFound) || loads.Load() != 1 {
+		t.Fatal("GetMany should be served by the negative entry")
+	}
+	time.Sleep(30 * time.Millisecond)
+	g.Get(context.Background(), "unknown")
+	if loads.Load() != 2 {
+		t.Fatal("the negative entry should expire after the ttl")
+	}
+
+	// only the keys not found are cached
+	loads.Store(0)
+	g = NewGroup("negative-errors", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		return nil, errors.New("db is down")
+	}), WithNegativeCache(time.Minute))
+	defer g.Close()
+	g.Get(context.Background(), "unknown")
+	g.Get(context.Background(), "unknown")
+	if loads.Load() != 2 {
+		t.Fatal("the other errors shouldn't be cached")
+	}
+
+	// disabled by default
+	loads.Store(0)
+	g = NewGroup("negative-disabled", 2<<10, getter)
+	defer g.Close()
+	g.Get(context.Background(), "unknown")
+	g.Get(context.Background(), "unknown")
+	if loads.Load() != 2 {
+		t.Fatal("the negative caching should be disabled by default")
+	}
+}
+
+func TestPeerNotFound(t *testing.T) {
+	g := NewGroup("peer-not-found", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("key %s should be answered by the peer", key)
+		}), WithNegativeCache(time.Minute), WithHotCacheBytes(0))
+	defer g.Close()
+	g.RegisterPeers(&fakePicker{peer: &fakePeer{notFound: true}})
+	if _, err := g.Get(context.Background(), "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("the not found error of the peer should be returned, but %v got", err)
+	}
+	if stats := g.Stats(); stats.PeerErrors != 0 || stats.LocalLoadErrs != 0 {
+		t.Fatal("the key not found by the peer shouldn't be loaded locally or taken as a peer error")
+	}
+}
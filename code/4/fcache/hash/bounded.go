@@ -0,0 +1,84 @@
+package hash
+
+import (
+	"math"
+)
+
+// BoundedMap is a Map with bounded loads (Mirrokni et al.),
+// a node takes at most (1+epsilon) times its share of the total load,
+// the key moves to the next node on the ring if its node is full,
+// the caller reports the load of the nodes by Inc and Done
+type BoundedMap struct {
+	*Map
+	epsilon float64
+	loads   map[string]int64 // the current load of every node
+	total   int64            // the sum of the loads
+}
+
+// NewBounded initialise a BoundedMap on the Map
+func NewBounded(m *Map, epsilon float64) *BoundedMap {
+	return &BoundedMap{
+		Map:     m,
+		epsilon: epsilon,
+		loads:   make(map[string]int64),
+	}
+}
+
+// Remove some real node with its key and its load
+func (b *BoundedMap) Remove(keys ...string) {
+	b.Map.Remove(keys...)
+	for _, key := range keys {
+		b.total -= b.loads[key]
+		delete(b.loads, key)
+	}
+}
+
+// Get gets the closet node which isn't full to the key
+func (b *BoundedMap) Get(key string) string {
+	return b.Lookup(key, func(string) bool { return true })
+}
+
+// Lookup walks the ring from the key and returns the first node which is accepted and isn't full,
+// the full nodes are only taken if all the accepted nodes are full
+func (b *BoundedMap) Lookup(key string, accept func(node string) bool) string {
+	totalWeight := 0
+	for _, w := range b.weights {
+		totalWeight += w
+	}
+	if totalWeight == 0 {
+		return ""
+	}
+	// the capacity counts the load of this key
+	avg := float64(b.total+1) / float64(totalWeight)
+	node := b.Map.Lookup(key, func(node string) bool {
+		capacity := int64(math.Ceil((1 + b.epsilon) * avg * float64(b.weights[node])))
+		return accept(node) && b.loads[node]+1 <= capacity
+	})
+	if node == "" {
+		node = b.Map.Lookup(key, accept)
+	}
+	return node
+}
+
+// Inc adds one load to the node, e.g. a request is sent to it
+func (b *BoundedMap) Inc(node string) {
+	if _, ok := b.weights[node]; !ok {
+		return
+	}
+	b.loads[node]++
+	b.total++
+}
+
+// Done removes one load from the node, e.g. a request to it is done
+func (b *BoundedMap) Done(node string) {
+	if b.loads[node] <= 0 {
+		return
+	}
+	b.loads[node]--
+	b.total--
+}
+
+// Load returns the current load of the node
+func (b *BoundedMap) Load(node string) int64 {
+	return b.loads[node]
+}
@@ -0,0 +1,55 @@
+package hash
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestBoundedLoads(t *testing.T) {
+	hash := NewBounded(New(50, nil), 0.25)
+	hash.Add("a", "b", "c", "d")
+
+	// a celebrity key is requested again and again before any request is done
+	const n = 100
+	for i := 0; i < n; i++ {
+		hash.Inc(hash.Get("celebrity"))
+	}
+	capacity := int64(math.Ceil(1.25 * n / 4))
+	for _, node := range []string{"a", "b", "c", "d"} {
+		if hash.Load(node) > capacity {
+			t.Errorf("the load of %s should be at most %d, but %d got", node, capacity, hash.Load(node))
+		}
+	}
+
+	// the key goes back to its node after the load is done
+	owner := hash.Map.Get("celebrity")
+	for _, node := range []string{"a", "b", "c", "d"} {
+		for hash.Load(node) > 0 {
+			hash.Done(node)
+		}
+	}
+	if node := hash.Get("celebrity"); node != owner {
+		t.Errorf("Asking for celebrity without load, should have yielded %s, but %s got", owner, node)
+	}
+}
+
+func TestBoundedLookup(t *testing.T) {
+	hash := NewBounded(New(50, nil), 0)
+	hash.Add("a", "b")
+	for i := 0; i < 100; i++ {
+		hash.Inc("a")
+		hash.Inc("b")
+	}
+	// all nodes are full, the accepted node is still returned
+	for i := 0; i < 10; i++ {
+		if node := hash.Lookup(strconv.Itoa(i), func(node string) bool { return node == "b" }); node != "b" {
+			t.Fatalf("the accepted node should be returned when all nodes are full, but %s got", node)
+		}
+	}
+
+	hash.Remove("a")
+	if hash.Load("a") != 0 || hash.total != 100 {
+		t.Fatal("the load of the removed node should be dropped")
+	}
+}
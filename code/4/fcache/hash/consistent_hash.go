@@ -1,45 +1,166 @@
 package hash
 
 import (
+	"fmt"
 	"hash/crc32"
+	"hash/fnv"
+	"slices"
 	"sort"
-	"strconv"
 )
 
 // Hash maps byte to uint32
 type Hash func(data []byte) uint32
 
+// Hash64 maps byte to uint64, the larger keyspace spreads the virtual nodes better
+type Hash64 func(data []byte) uint64
+
+// replicaWidth is the width of the index in the name of a virtual node,
+// the fixed width keeps the names of different nodes apart, e.g. 1 + "12" and 11 + "2"
+const replicaWidth = 8
+
 // Map contains all hashed keys
 type Map struct {
-	hash     Hash           // the implement of hash
-	replicas int            // the number of virtual nodes
-	keys     []int          // sorted index
-	hashMap  map[int]string // sorted the index to key
+	hash     Hash64              // the implement of hash
+	replicas int                 // the number of virtual nodes
+	keys     []uint64            // sorted index
+	hashMap  map[uint64][]string // the index to the sorted nodes, more than one node if their hashes collide
+	weights  map[string]int      // the weight of every node
 }
 
 // New initialise a Map
 func New(replicas int, hash Hash) *Map {
+	if hash == nil {
+		hash = crc32.ChecksumIEEE
+	}
+	return New64(replicas, func(data []byte) uint64 {
+		return uint64(hash(data))
+	})
+}
+
+// New64 initialise a Map with the 64-bit hash, MixFNV64a is used if it's nil
+func New64(replicas int, hash Hash64) *Map {
 	m := &Map{
 		hash:     hash,
 		replicas: replicas,
-		hashMap:  make(map[int]string),
+		hashMap:  make(map[uint64][]string),
+		weights:  make(map[string]int),
 	}
 	if m.hash == nil {
-		m.hash = crc32.ChecksumIEEE
+		m.hash = MixFNV64a
 	}
 	return m
 }
 
-// Add some real node with its key (name or ip etc.)
+// FNV64a is the 64-bit FNV-1a hash
+func FNV64a(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// MixFNV64a is FNV64a with the murmur3 finalizer, it spreads the similar names evenly
+func MixFNV64a(data []byte) uint64 {
+	return mix(FNV64a(data))
+}
+
+// replicaKey is the name of the i-th virtual node of the node
+func replicaKey(i int, key string) []byte {
+	return []byte(fmt.Sprintf("%0*d%s", replicaWidth, i, key))
+}
+
+// Add some real node with its key (name or ip etc.), adding a node twice is a no-op
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		if _, ok := m.weights[key]; !ok {
+			m.add(key, 1)
+		}
+	}
+	m.sortKeys()
+}
+
+// AddWeighted adds a real node with weight * replicas virtual nodes,
+// so it takes the keys in proportion to its weight, the weight less than 1 is taken as 1,
+// the virtual nodes of an existing node are rebuilt if its weight changes
+func (m *Map) AddWeighted(key string, weight int) {
+	weight = max(weight, 1)
+	if w, ok := m.weights[key]; ok {
+		if w == weight {
+			return
+		}
+		m.Remove(key)
+	}
+	m.add(key, weight)
+	m.sortKeys()
+}
+
+// add the virtual nodes of the real node without sorting
+func (m *Map) add(key string, weight int) {
+	m.weights[key] = weight
+	for i := 0; i < m.replicas*weight; i++ {
+		hash := m.hash(replicaKey(i, key))
+		nodes, ok := m.hashMap[hash]
+		if !ok {
 			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+		}
+		// the colliding nodes are sorted, so that all peers agree on the owner
+		idx := sort.SearchStrings(nodes, key)
+		if idx < len(nodes) && nodes[idx] == key {
+			continue
+		}
+		m.hashMap[hash] = slices.Insert(nodes, idx, key)
+	}
+}
+
+// sortKeys sorts the index of the virtual nodes
+func (m *Map) sortKeys() {
+	slices.Sort(m.keys)
+}
+
+// Remove some real node with its key, only the keys on the removed node move to the next nodes
+func (m *Map) Remove(keys ...string) {
+	removed := make(map[uint64]struct{})
+	for _, key := range keys {
+		weight, ok := m.weights[key]
+		if !ok {
+			continue
+		}
+		delete(m.weights, key)
+		for i := 0; i < m.replicas*weight; i++ {
+			hash := m.hash(replicaKey(i, key))
+			nodes := m.hashMap[hash]
+			idx := sort.SearchStrings(nodes, key)
+			if idx == len(nodes) || nodes[idx] != key {
+				continue
+			}
+			if len(nodes) == 1 {
+				delete(m.hashMap, hash)
+				removed[hash] = struct{}{}
+				continue
+			}
+			m.hashMap[hash] = slices.Delete(nodes, idx, idx+1)
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	// m.keys stays sorted after filtering
+	kept := m.keys[:0]
+	for _, hash := range m.keys {
+		if _, ok := removed[hash]; !ok {
+			kept = append(kept, hash)
 		}
 	}
-	sort.Ints(m.keys)
+	m.keys = kept
+}
+
+// search returns the index of the first virtual node from the key
+func (m *Map) search(key string) int {
+	hash := m.hash([]byte(key))
+	// Binary search for appropriate replica
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	return idx % len(m.keys)
 }
 
 // Get gets the closet item in the hash to provider key.
@@ -47,12 +168,42 @@ func (m *Map) Get(key string) string {
 	if len(m.keys) == 0 {
 		return ""
 	}
+	return m.hashMap[m.keys[m.search(key)]][0]
+}
 
-	hash := int(m.hash([]byte(key)))
-	// Binary search for appropriate replica
-	idx := sort.Search(len(m.keys), func(i int) bool {
-		return m.keys[i] >= hash
+// GetN gets the first n distinct nodes on the ring from the key in order,
+// the first one is the same as Get, fewer nodes are returned if there aren't enough
+func (m *Map) GetN(key string, n int) []string {
+	nodes := make([]string, 0, n)
+	if n <= 0 {
+		return nodes
+	}
+	m.Lookup(key, func(node string) bool {
+		nodes = append(nodes, node)
+		return len(nodes) == n
 	})
+	return nodes
+}
 
-	return m.hashMap[m.keys[idx%len(m.keys)]]
+// Lookup walks the ring from the key and returns the first node accepted,
+// every distinct node is asked once, it returns "" if no node is accepted
+func (m *Map) Lookup(key string, accept func(node string) bool) string {
+	if len(m.keys) == 0 {
+		return ""
+	}
+
+	idx := m.search(key)
+	seen := make(map[string]struct{})
+	for i := 0; i < len(m.keys) && len(seen) < len(m.weights); i++ {
+		for _, node := range m.hashMap[m.keys[(idx+i)%len(m.keys)]] {
+			if _, ok := seen[node]; ok {
+				continue
+			}
+			if accept(node) {
+				return node
+			}
+			seen[node] = struct{}{}
+		}
+	}
+	return ""
 }
@@ -2,6 +2,7 @@ package hash
 
 import (
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -41,3 +42,165 @@ func TestHashing(t *testing.T) {
 	}
 
 }
+
+func TestLookup(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	all := func(node string) bool { return true }
+	if hash.Lookup("11", all) != hash.Get("11") {
+		t.Fatal("Lookup should be the same as Get if all nodes are accepted")
+	}
+	// 11 belongs to 2, the next distinct node is 4
+	if node := hash.Lookup("11", func(node string) bool { return node != "2" }); node != "4" {
+		t.Errorf("Asking for 11 without 2, should have yielded 4, but %s got", node)
+	}
+	// 27 wraps around to 2, then 4 and 6
+	if node := hash.Lookup("27", func(node string) bool { return node == "6" }); node != "6" {
+		t.Errorf("Asking for 27 with only 6, should have yielded 6, but %s got", node)
+	}
+	asked := 0
+	if node := hash.Lookup("11", func(node string) bool { asked++; return false }); node != "" || asked != 3 {
+		t.Errorf("every distinct node should be asked once, but %d asked and %s got", asked, node)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	// Removes 4, 14, 24
+	hash.Remove("4")
+	testCases := map[string]string{
+		"2":  "2",
+		"3":  "6",
+		"11": "2",
+		"23": "6",
+		"27": "2",
+	}
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+
+	hash.Remove("2", "6")
+	if node := hash.Get("2"); node != "" {
+		t.Errorf("the empty ring should yield nothing, but %s got", node)
+	}
+}
+
+func TestAddWeighted(t *testing.T) {
+	hash := New(100, nil)
+	weights := map[string]int{"small": 1, "medium": 2, "large": 4}
+	for node, weight := range weights {
+		hash.AddWeighted(node, weight)
+	}
+
+	const n = 100000
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[hash.Get("key"+strconv.Itoa(i))]++
+	}
+	for node, weight := range weights {
+		expect := float64(n) * float64(weight) / 7
+		if got := float64(counts[node]); got < expect*0.8 || got > expect*1.2 {
+			t.Errorf("%s should take about %.0f keys, but %.0f got", node, expect, got)
+		}
+	}
+
+	hash.Remove("large")
+	for i := 0; i < 1000; i++ {
+		if node := hash.Get("key" + strconv.Itoa(i)); node == "large" {
+			t.Fatal("all virtual nodes of the weighted node should be removed")
+		}
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	testCases := map[string][]string{
+		"11": {"2", "4"},
+		"23": {"4", "6"},
+		"27": {"2", "4"},
+	}
+	for k, v := range testCases {
+		if nodes := hash.GetN(k, 2); strings.Join(nodes, ",") != strings.Join(v, ",") {
+			t.Errorf("Asking for %s, should have yielded %v, but %v got", k, v, nodes)
+		}
+	}
+	if nodes := hash.GetN("11", 5); len(nodes) != 3 {
+		t.Errorf("only the 3 distinct nodes should be yielded, but %v got", nodes)
+	}
+}
+
+func TestCollision(t *testing.T) {
+	// all virtual nodes collide
+	hash := New(3, func(key []byte) uint32 { return 1 })
+	hash.Add("b", "a", "c")
+	if node := hash.Get("key"); node != "a" {
+		t.Errorf("the smallest node should own the colliding virtual node, but %s got", node)
+	}
+	if nodes := hash.GetN("key", 3); strings.Join(nodes, ",") != "a,b,c" {
+		t.Errorf("all colliding nodes should be walked, but %v got", nodes)
+	}
+	hash.Remove("a")
+	if node := hash.Get("key"); node != "b" {
+		t.Errorf("the colliding node should take over after the owner is removed, but %s got", node)
+	}
+}
+
+func TestAddTwice(t *testing.T) {
+	hash := New(3, nil)
+	hash.Add("a", "b")
+	keys := len(hash.keys)
+	hash.Add("a")
+	hash.AddWeighted("b", 1)
+	if len(hash.keys) != keys {
+		t.Fatalf("adding a node twice shouldn't add virtual nodes, %d to %d", keys, len(hash.keys))
+	}
+	hash.AddWeighted("b", 2)
+	if len(hash.keys) != keys+3 {
+		t.Fatalf("changing the weight should rebuild the virtual nodes, but %d got", len(hash.keys))
+	}
+	hash.Remove("a")
+	hash.Remove("b")
+	if len(hash.keys) != 0 || len(hash.hashMap) != 0 {
+		t.Fatal("all virtual nodes should be removed")
+	}
+}
+
+func TestReplicaKey(t *testing.T) {
+	// the indexes of different nodes used to collide, e.g. 1 + "12" and 11 + "2"
+	if string(replicaKey(1, "12")) == string(replicaKey(11, "2")) {
+		t.Fatal("the names of the virtual nodes of different nodes shouldn't collide")
+	}
+}
+
+func TestHash64(t *testing.T) {
+	hash := New64(100, nil)
+	hash.Add("a", "b", "c")
+	counts := make(map[string]int)
+	for i := 0; i < 30000; i++ {
+		counts[hash.Get("key"+strconv.Itoa(i))]++
+	}
+	for _, node := range []string{"a", "b", "c"} {
+		if counts[node] < 7000 || counts[node] > 13000 {
+			t.Errorf("%s should take about 10000 keys, but %d got", node, counts[node])
+		}
+	}
+}
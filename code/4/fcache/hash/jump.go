@@ -0,0 +1,82 @@
+package hash
+
+import (
+	"hash/crc32"
+)
+
+// Jump is the jump consistent hash (Lamping and Veach),
+// it takes no memory but the list of the nodes and spreads the keys evenly,
+// the keys only move to a node added at the end, so a removed node is replaced by the last one,
+// which moves the keys of the both nodes,
+// all peers must add and remove the nodes in the same order to agree on the keys,
+// so the HttpPool only appends the nodes and keeps the removed ones to skip them
+type Jump struct {
+	hash  Hash
+	nodes []string
+}
+
+// NewJump initialise a Jump, crc32 is used if the hash is nil
+func NewJump(hash Hash) *Jump {
+	if hash == nil {
+		hash = crc32.ChecksumIEEE
+	}
+	return &Jump{hash: hash}
+}
+
+// Add some real node at the end
+func (j *Jump) Add(nodes ...string) {
+	for _, node := range nodes {
+		if indexOf(j.nodes, node) < 0 {
+			j.nodes = append(j.nodes, node)
+		}
+	}
+}
+
+// Remove some real node, the last node takes its place
+func (j *Jump) Remove(nodes ...string) {
+	for _, node := range nodes {
+		if i := indexOf(j.nodes, node); i >= 0 {
+			last := len(j.nodes) - 1
+			j.nodes[i] = j.nodes[last]
+			j.nodes = j.nodes[:last]
+		}
+	}
+}
+
+// Ordered reports true, the buckets are the nodes in the order they're added
+func (j *Jump) Ordered() bool {
+	return true
+}
+
+// jump returns the bucket of the key in [0, n)
+func jump(key uint64, n int) int {
+	var b, i int64 = -1, 0
+	for i < int64(n) {
+		b = i
+		key = key*2862933555777941757 + 1
+		i = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// Get gets the node of the bucket of the key
+func (j *Jump) Get(key string) string {
+	if len(j.nodes) == 0 {
+		return ""
+	}
+	return j.nodes[jump(uint64(j.hash([]byte(key))), len(j.nodes))]
+}
+
+// Lookup asks the node of the bucket of the key, and then the next nodes in the list
+func (j *Jump) Lookup(key string, accept func(node string) bool) string {
+	if len(j.nodes) == 0 {
+		return ""
+	}
+	b := jump(uint64(j.hash([]byte(key))), len(j.nodes))
+	for i := 0; i < len(j.nodes); i++ {
+		if node := j.nodes[(b+i)%len(j.nodes)]; accept(node) {
+			return node
+		}
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package hash
+
+import (
+	"hash/crc32"
+	"sort"
+)
+
+// DefaultMaglevSize is the size of the lookup table, it should be a prime much larger than the nodes
+const DefaultMaglevSize = 65537
+
+// Maglev is the Maglev hashing (Eisenbud et al.),
+// every node fills the lookup table by its own permutation in turn,
+// so the nodes take almost the same number of entries and Get costs O(1),
+// the table is rebuilt on every change, which moves a few more keys than the ring
+type Maglev struct {
+	hash  Hash
+	size  int
+	nodes []string
+	// the index of the node of every entry, -1 for the empty table
+	table []int
+}
+
+// NewMaglev initialise a Maglev with the size of the lookup table,
+// DefaultMaglevSize is used if the size is zero, crc32 is used if the hash is nil,
+// the size is rounded up to a prime, otherwise a permutation may never reach the empty entries
+func NewMaglev(size int, hash Hash) *Maglev {
+	if size == 0 {
+		size = DefaultMaglevSize
+	}
+	size = nextPrime(size)
+	if hash == nil {
+		hash = crc32.ChecksumIEEE
+	}
+	return &Maglev{hash: hash, size: size}
+}
+
+// Add some real node and rebuild the table
+func (m *Maglev) Add(nodes ...string) {
+	for _, node := range nodes {
+		if indexOf(m.nodes, node) < 0 {
+			m.nodes = append(m.nodes, node)
+		}
+	}
+	m.populate()
+}
+
+// Remove some real node and rebuild the table
+func (m *Maglev) Remove(nodes ...string) {
+	for _, node := range nodes {
+		if i := indexOf(m.nodes, node); i >= 0 {
+			m.nodes = append(m.nodes[:i], m.nodes[i+1:]...)
+		}
+	}
+	m.populate()
+}
+
+// populate fills the table, every node takes the next empty entry of its permutation in turn,
+// the nodes are sorted so that the table doesn't depend on the order they're added
+func (m *Maglev) populate() {
+	m.table = nil
+	if len(m.nodes) == 0 {
+		return
+	}
+	sort.Strings(m.nodes)
+	// the permutation of a node is offset, offset+skip, offset+2*skip ... mod size
+	offsets := make([]int, len(m.nodes))
+	skips := make([]int, len(m.nodes))
+	next := make([]int, len(m.nodes))
+	for i, node := range m.nodes {
+		h := mix(uint64(m.hash([]byte(node))))
+		offsets[i] = int(h % uint64(m.size))
+		skips[i] = int((h>>32)%uint64(m.size-1)) + 1
+	}
+
+	m.table = make([]int, m.size)
+	for i := range m.table {
+		m.table[i] = -1
+	}
+	for filled := 0; ; {
+		for i := range m.nodes {
+			entry := (offsets[i] + next[i]*skips[i]) % m.size
+			for m.table[entry] >= 0 {
+				next[i]++
+				entry = (offsets[i] + next[i]*skips[i]) % m.size
+			}
+			m.table[entry] = i
+			next[i]++
+			if filled++; filled == m.size {
+				return
+			}
+		}
+	}
+}
+
+// nextPrime returns the smallest prime not less than n, 2 at least
+func nextPrime(n int) int {
+	for n = max(n, 2); ; n++ {
+		prime := true
+		for d := 2; d*d <= n; d++ {
+			if n%d == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			return n
+		}
+	}
+}
+
+// entry returns the entry of the key in the table
+func (m *Maglev) entry(key string) int {
+	return int(mix(uint64(m.hash([]byte(key)))) % uint64(m.size))
+}
+
+// Get gets the node of the entry of the key
+func (m *Maglev) Get(key string) string {
+	if len(m.table) == 0 {
+		return ""
+	}
+	return m.nodes[m.table[m.entry(key)]]
+}
+
+// Lookup asks the node of the entry of the key, and then the nodes of the next entries
+func (m *Maglev) Lookup(key string, accept func(node string) bool) string {
+	if len(m.table) == 0 {
+		return ""
+	}
+	seen := make(map[int]struct{}, len(m.nodes))
+	entry := m.entry(key)
+	for i := 0; i < m.size && len(seen) < len(m.nodes); i++ {
+		node := m.table[(entry+i)%m.size]
+		if _, ok := seen[node]; ok {
+			continue
+		}
+		if accept(m.nodes[node]) {
+			return m.nodes[node]
+		}
+		seen[node] = struct{}{}
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package hash
+
+// Placement maps the keys to the nodes, Map is the default consistent hash ring
+type Placement interface {
+	// Add some real node
+	Add(nodes ...string)
+	// Remove some real node
+	Remove(nodes ...string)
+	// Get gets the node of the key, "" if there is no node
+	Get(key string) string
+	// Lookup walks the candidates of the key in order and returns the first node accepted,
+	// every distinct node is asked once, it returns "" if no node is accepted
+	Lookup(key string, accept func(node string) bool) string
+}
+
+// WeightedPlacement is a Placement which takes the keys in proportion to the weight of the nodes
+type WeightedPlacement interface {
+	Placement
+	AddWeighted(node string, weight int)
+}
+
+// OrderedPlacement is a Placement whose owners depend on the order the nodes are added and removed,
+// the peers must add the nodes in the same order to agree on the owners
+type OrderedPlacement interface {
+	Placement
+	// Ordered reports whether the owners depend on the order of the nodes
+	Ordered() bool
+}
+
+var (
+	_ WeightedPlacement = (*Map)(nil)
+	_ WeightedPlacement = (*BoundedMap)(nil)
+	_ Placement         = (*Rendezvous)(nil)
+	_ OrderedPlacement  = (*Jump)(nil)
+	_ Placement         = (*Maglev)(nil)
+)
+
+// mix spreads the bits of x, it's the finalizer of murmur3
+func mix(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// indexOf returns the index of the node in the nodes, -1 if it's not in
+func indexOf(nodes []string, node string) int {
+	for i, n := range nodes {
+		if n == node {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,155 @@
+package hash
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+)
+
+// placements are the Placements to compare
+var placements = []struct {
+	name string
+	new  func() Placement
+}{
+	{"ring", func() Placement { return New(50, nil) }},
+	{"ring64", func() Placement { return New64(50, nil) }},
+	{"ring-bounded", func() Placement { return NewBounded(New(50, nil), 0.25) }},
+	{"rendezvous", func() Placement { return NewRendezvous(nil) }},
+	{"jump", func() Placement { return NewJump(nil) }},
+	{"maglev", func() Placement { return NewMaglev(0, nil) }},
+}
+
+func nodeNames(n int) []string {
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("http://10.0.0.%d:8001", i)
+	}
+	return nodes
+}
+
+// placementStats is measured by the harness
+type placementStats struct {
+	// the coefficient of variation of the keys per node, lower is more balanced
+	cv float64
+	// the fraction of the keys moved when one node is added and removed
+	addMoved, removeMoved float64
+}
+
+// measure places the keys on n nodes, then adds one node and removes one node
+func measure(p Placement, n, keys int) placementStats {
+	nodes := nodeNames(n + 1)
+	p.Add(nodes[:n]...)
+
+	owners := make([]string, keys)
+	counts := make(map[string]int, n)
+	for i := range owners {
+		owners[i] = p.Get("key" + strconv.Itoa(i))
+		counts[owners[i]]++
+	}
+	mean := float64(keys) / float64(n)
+	variance := 0.0
+	for _, node := range nodes[:n] {
+		variance += (float64(counts[node]) - mean) * (float64(counts[node]) - mean)
+	}
+	stats := placementStats{cv: math.Sqrt(variance/float64(n)) / mean}
+
+	moved := func() float64 {
+		count := 0
+		for i, owner := range owners {
+			if p.Get("key"+strconv.Itoa(i)) != owner {
+				count++
+			}
+		}
+		return float64(count) / float64(keys)
+	}
+	p.Add(nodes[n])
+	stats.addMoved = moved()
+	p.Remove(nodes[n])
+	p.Remove(nodes[0])
+	stats.removeMoved = moved()
+	return stats
+}
+
+func TestPlacements(t *testing.T) {
+	for _, pc := range placements {
+		t.Run(pc.name, func(t *testing.T) {
+			p := pc.new()
+			if p.Get("key") != "" {
+				t.Fatal("the empty placement should yield nothing")
+			}
+			nodes := nodeNames(3)
+			p.Add(nodes...)
+			p.Add(nodes[0])
+			owner := p.Get("key")
+			if indexOf(nodes, owner) < 0 {
+				t.Fatalf("the key should go to a node, but %s got", owner)
+			}
+			if node := p.Lookup("key", func(string) bool { return true }); node != owner {
+				t.Fatalf("Lookup should be the same as Get if all nodes are accepted, but %s got", node)
+			}
+			asked := 0
+			next := p.Lookup("key", func(node string) bool { asked++; return node != owner })
+			if next == owner || indexOf(nodes, next) < 0 {
+				t.Fatalf("Lookup should skip the rejected node, but %s got", next)
+			}
+			if p.Lookup("key", func(string) bool { return false }) != "" {
+				t.Fatal("Lookup should yield nothing if no node is accepted")
+			}
+
+			p.Remove(owner)
+			for i := 0; i < 1000; i++ {
+				if p.Get("key"+strconv.Itoa(i)) == owner {
+					t.Fatal("no key should go to the removed node")
+				}
+			}
+		})
+	}
+}
+
+func TestPlacementStability(t *testing.T) {
+	const n, keys = 10, 100000
+	for _, pc := range placements {
+		s := measure(pc.new(), n, keys)
+		t.Logf("%-12s cv %.3f, moved %.3f on add, %.3f on remove", pc.name, s.cv, s.addMoved, s.removeMoved)
+		// the ideal is 1/(n+1) on add and 1/n on remove, the jump moves two nodes on remove
+		if s.addMoved > 2.0/(n+1) || s.removeMoved > 2.5/n {
+			t.Errorf("%s moves too many keys: %.3f on add, %.3f on remove", pc.name, s.addMoved, s.removeMoved)
+		}
+	}
+}
+
+func BenchmarkPlacement(b *testing.B) {
+	for _, n := range []int{10, 100} {
+		for _, pc := range placements {
+			b.Run(fmt.Sprintf("%s/nodes=%d", pc.name, n), func(b *testing.B) {
+				p := pc.new()
+				p.Add(nodeNames(n)...)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					p.Get("key" + strconv.Itoa(i))
+				}
+				b.StopTimer()
+				s := measure(pc.new(), n, 20000)
+				b.ReportMetric(s.cv, "cv")
+				b.ReportMetric(100*s.addMoved, "add-moved%")
+				b.ReportMetric(100*s.removeMoved, "remove-moved%")
+			})
+		}
+	}
+}
+
+func TestMaglevSize(t *testing.T) {
+	for size, want := range map[int]int{-1: 2, 1: 2, 2: 2, 12: 13, 13: 13, 0: DefaultMaglevSize} {
+		if got := NewMaglev(size, nil).size; got != want {
+			t.Errorf("the size %d should be rounded up to %d, but %d got", size, want, got)
+		}
+	}
+	for _, size := range []int{1, 12} {
+		m := NewMaglev(size, nil)
+		m.Add(nodeNames(5)...)
+		if m.Get("key") == "" {
+			t.Fatalf("the key should go to a node with the size %d", size)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package hash
+
+import (
+	"hash/crc32"
+	"sort"
+)
+
+// Rendezvous is the highest random weight hashing,
+// the key goes to the node with the highest score of the key and the node,
+// only the keys of a removed node move, and a new node only takes its keys,
+// Get costs O(n) with n nodes
+type Rendezvous struct {
+	hash  Hash
+	nodes []string
+	// the hash of every node, in the order of the nodes
+	hashes []uint32
+}
+
+// NewRendezvous initialise a Rendezvous, crc32 is used if the hash is nil
+func NewRendezvous(hash Hash) *Rendezvous {
+	if hash == nil {
+		hash = crc32.ChecksumIEEE
+	}
+	return &Rendezvous{hash: hash}
+}
+
+// Add some real node
+func (r *Rendezvous) Add(nodes ...string) {
+	for _, node := range nodes {
+		if indexOf(r.nodes, node) >= 0 {
+			continue
+		}
+		r.nodes = append(r.nodes, node)
+		r.hashes = append(r.hashes, r.hash([]byte(node)))
+	}
+}
+
+// Remove some real node
+func (r *Rendezvous) Remove(nodes ...string) {
+	for _, node := range nodes {
+		if i := indexOf(r.nodes, node); i >= 0 {
+			r.nodes = append(r.nodes[:i], r.nodes[i+1:]...)
+			r.hashes = append(r.hashes[:i], r.hashes[i+1:]...)
+		}
+	}
+}
+
+// score of the key on the i-th node
+func (r *Rendezvous) score(key uint32, i int) uint64 {
+	return mix(uint64(key)<<32 | uint64(r.hashes[i]))
+}
+
+// Get gets the node with the highest score
+func (r *Rendezvous) Get(key string) string {
+	if len(r.nodes) == 0 {
+		return ""
+	}
+	h := r.hash([]byte(key))
+	best := 0
+	for i := 1; i < len(r.nodes); i++ {
+		if r.score(h, i) > r.score(h, best) {
+			best = i
+		}
+	}
+	return r.nodes[best]
+}
+
+// Lookup asks the nodes from the highest score to the lowest
+func (r *Rendezvous) Lookup(key string, accept func(node string) bool) string {
+	h := r.hash([]byte(key))
+	order := make([]int, len(r.nodes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return r.score(h, order[i]) > r.score(h, order[j])
+	})
+	for _, i := range order {
+		if accept(r.nodes[i]) {
+			return r.nodes[i]
+		}
+	}
+	return ""
+}
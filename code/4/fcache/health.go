@@ -0,0 +1,120 @@
+package fcache
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultFailureThreshold a peer is marked down after so many failed requests in a row
+	defaultFailureThreshold = 3
+	// defaultProbeInterval how often the down peers are probed
+	defaultProbeInterval = 5 * time.Second
+)
+
+// healthTracker records the health of the peers,
+// a peer is marked down by the failed requests and marked up again by a successful probe
+type healthTracker struct {
+	mu sync.Mutex
+	// the consecutive failures of every peer
+	failures map[string]int
+	// the peers marked down
+	down      map[string]struct{}
+	threshold int
+}
+
+func newHealthTracker(threshold int) *healthTracker {
+	return &healthTracker{
+		failures:  make(map[string]int),
+		down:      make(map[string]struct{}),
+		threshold: threshold,
+	}
+}
+
+// healthy reports whether the peer isn't marked down
+func (t *healthTracker) healthy(peer string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, down := t.down[peer]
+	return !down
+}
+
+// success resets the failures of the peer and marks it up,
+// it returns true if the peer was down
+func (t *healthTracker) success(peer string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, peer)
+	if _, down := t.down[peer]; down {
+		delete(t.down, peer)
+		return true
+	}
+	return false
+}
+
+// failure counts a failed request to the peer,
+// it returns true if the peer is marked down by this failure
+func (t *healthTracker) failure(peer string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures[peer]++
+	if _, down := t.down[peer]; down || t.failures[peer] < t.threshold {
+		return false
+	}
+	t.down[peer] = struct{}{}
+	return true
+}
+
+// downPeers returns the peers marked down
+func (t *healthTracker) downPeers() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	peers := make([]string, 0, len(t.down))
+	for peer := range t.down {
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// markFailure counts a failed request to the peer in the tracker of the pool
+func (p *HttpPool) markFailure(peer string, err error) {
+	if p.health.failure(peer) {
+		p.log().Warn("peer is down", "self", p.self, "peer", peer, "err", err)
+	}
+}
+
+// markSuccess counts a successful request to the peer in the tracker of the pool
+func (p *HttpPool) markSuccess(peer string) {
+	if p.health.success(peer) {
+		p.log().Info("peer is up", "self", p.self, "peer", peer)
+	}
+}
+
+// probe checks the down peers periodically, a peer answers the probe by GET /<basePath>
+func (p *HttpPool) probe() {
+	ticker := time.NewTicker(p.opts.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.done:
+			return
+		}
+		for _, peer := range p.health.downPeers() {
+			p.mu.Lock()
+			getter := p.httpGetter[peer]
+			p.mu.Unlock()
+			if getter == nil {
+				// the peer has left the pool
+				p.health.success(peer)
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), p.opts.ProbeInterval)
+			// the result is recorded by the getter
+			_, _ = getter.do(ctx, http.MethodGet, getter.baseURL, nil)
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package fcache
+
+import (
+	"context"
+	"errors"
+	pb "github.com/univero/fcache/fcache/cachepb"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyTransport fails all requests while it's down
+type flakyTransport struct {
+	down atomic.Bool
+}
+
+func (t *flakyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.down.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestPeerFailover(t *testing.T) {
+	g := NewGroup("health", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}))
+	defer g.Close()
+	server := NewHttpPool("peer")
+	defer server.Close()
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	transport := &flakyTransport{}
+	pool := NewHttpPoolOpts("self", &HttpPoolOptions{
+		Transport:        transport,
+		FailureThreshold: 2,
+		ProbeInterval:    10 * time.Millisecond,
+	})
+	defer pool.Close()
+	pool.Set("self", srv.URL)
+
+	// find a key owned by the peer
+	key := ""
+	for i := 0; key == ""; i++ {
+		if _, ok := pool.PickPeer(strconv.Itoa(i)); ok {
+			key = strconv.Itoa(i)
+		}
+	}
+
+	transport.down.Store(true)
+	peer, _ := pool.PickPeer(key)
+	for i := 0; i < 2; i++ {
+		if err := peer.Get(context.Background(), &pb.Request{Group: "health", Key: "Tom"}, &pb.Response{}); err == nil {
+			t.Fatal("the request should fail while the peer is down")
+		}
+	}
+	if _, ok := pool.PickPeer(key); ok {
+		t.Fatal("the down peer should be skipped")
+	}
+
+	transport.down.Store(false)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := pool.PickPeer(key); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the peer should be picked again after a successful probe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	pool := NewHttpPoolOpts("self", &HttpPoolOptions{ProbeInterval: time.Millisecond})
+	pool.Close()
+	pool.Close()
+	select {
+	case <-pool.done:
+	default:
+		t.Fatal("the probe should be stopped by Close")
+	}
+}
@@ -1,21 +1,29 @@
 package fcache
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	pb "github.com/univero/fcache/fcache/cachepb"
 	"github.com/univero/fcache/fcache/hash"
 	"google.golang.org/protobuf/proto"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
 	defaultBasePath = "/_fcache/"
 	defaultReplicas = 50
+	// the paths under the base path to ask for and to release the load lease
+	leasePath   = "_lease"
+	releasePath = "_release"
 )
 
 // HttpPool implements PeerPicker for a pool of Http peer
@@ -25,54 +33,364 @@ type HttpPool struct {
 	basePath string
 	mu       sync.Mutex
 	// use consistent hash to choose node with the key
-	peers *hash.Map
+	peers hash.Placement
+	// bounds the in-flight requests to every peer on the same ring, nil if it's disabled
+	loads *hash.BoundedMap
 	// map node to its httpGetter
 	httpGetter map[string]*httpGetter
+	// the latency of the requests to the peers
+	metrics peerMetrics
+	// nil means slog.Default()
+	logger *slog.Logger
+	opts   HttpPoolOptions
+	// the down peers are skipped by PickPeer
+	health *healthTracker
+	// closed by Close to stop the probe
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// HttpPoolOptions are the configurations of a HttpPool
+type HttpPoolOptions struct {
+	// BasePath specifies the HTTP path that will serve fcache requests,
+	// it must be the same on all peers, defaultBasePath is used if it's empty
+	BasePath string
+	// Replicas specifies the number of virtual nodes of each peer, defaultReplicas is used if it's zero
+	Replicas int
+	// HashFn specifies the hash function of the consistent hash, crc32 is used if it's nil
+	HashFn hash.Hash
+	// HashFn64 specifies the 64-bit hash function of the consistent hash, e.g. hash.MixFNV64a,
+	// it takes precedence over the HashFn, the larger keyspace spreads the peers more evenly
+	HashFn64 hash.Hash64
+	// Placement builds the empty placement of the peers instead of the consistent hash ring,
+	// e.g. hash.NewRendezvous, the Replicas, HashFn, HashFn64 and LoadEpsilon are only used by the ring,
+	// the Weights are only used if it's a hash.WeightedPlacement,
+	// a hash.OrderedPlacement such as hash.NewJump only suits the append-only membership,
+	// every peer must Set and add the peers in the same order, and a removed peer keeps its bucket,
+	// so that its keys move to the next peers and it takes them back when it's added again
+	Placement func() hash.Placement
+	// Weights specifies the weight of the peers added by Set and AddPeers,
+	// a peer takes the keys in proportion to its weight, 1 is used for the peers not in it
+	Weights map[string]int
+	// Transport is used by the requests to the peers, http.DefaultTransport is used if it's nil
+	Transport http.RoundTripper
+	// Client is used by the requests to the peers, it takes precedence over the Transport,
+	// set its Timeout to bound the requests
+	Client *http.Client
+	// FailureThreshold specifies how many failed requests in a row mark a peer down,
+	// defaultFailureThreshold is used if it's zero
+	FailureThreshold int
+	// ProbeInterval specifies how often the down peers are probed, defaultProbeInterval is used if it's zero
+	ProbeInterval time.Duration
+	// LoadEpsilon enables the consistent hashing with bounded loads if it's positive,
+	// a peer takes at most (1+LoadEpsilon) times its share of the in-flight requests from this pool,
+	// and the keys move to the next peer on the ring if it's full
+	LoadEpsilon float64
 }
 
 // NewHttpPool return a HttpPool with defaultBasePath
 func NewHttpPool(self string) *HttpPool {
-	return &HttpPool{self: self, basePath: defaultBasePath}
+	return NewHttpPoolOpts(self, nil)
+}
+
+// NewHttpPoolOpts return a HttpPool with the options, nil options means all defaults
+func NewHttpPoolOpts(self string, o *HttpPoolOptions) *HttpPool {
+	p := &HttpPool{self: self}
+	if o != nil {
+		p.opts = *o
+	}
+	if p.opts.BasePath == "" {
+		p.opts.BasePath = defaultBasePath
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	if p.opts.Client == nil {
+		p.opts.Client = &http.Client{Transport: p.opts.Transport}
+	}
+	if p.opts.FailureThreshold == 0 {
+		p.opts.FailureThreshold = defaultFailureThreshold
+	}
+	if p.opts.ProbeInterval == 0 {
+		p.opts.ProbeInterval = defaultProbeInterval
+	}
+	p.basePath = p.opts.BasePath
+	p.health = newHealthTracker(p.opts.FailureThreshold)
+	p.done = make(chan struct{})
+	go p.probe()
+	return p
+}
+
+// Close stops probing the down peers, the pool still serves and picks the peers
+func (p *HttpPool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
 }
 
-// Log with server name
+// SetLogger sets the logger of the pool and its clients, slog.Default() is used if it's nil
+func (p *HttpPool) SetLogger(logger *slog.Logger) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.logger = logger
+}
+
+// log returns the logger of the pool
+func (p *HttpPool) log() *slog.Logger {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.logger == nil {
+		return slog.Default()
+	}
+	return p.logger
+}
+
+// Log with server name at the info level
 func (p *HttpPool) Log(format string, v ...interface{}) {
-	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+	p.log().Info(fmt.Sprintf(format, v...), "self", p.self)
 }
 
 // Set updates the pool's list of peers
+// the getters of the peers still in the list are kept
 func (p *HttpPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = hash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpGetter = make(map[string]*httpGetter, len(peers))
+	p.newRing()
+	getters := make(map[string]*httpGetter, len(peers))
+	for _, peer := range peers {
+		p.addWeighted(peer, p.weight(peer))
+		getters[peer] = p.getter(peer)
+	}
+	p.httpGetter = getters
+}
+
+// serving reports whether the node is one of the peers, it's false for a removed node
+// kept by an append-only placement, it must be called with p.mu held
+func (p *HttpPool) serving(node string) bool {
+	_, ok := p.httpGetter[node]
+	return ok
+}
+
+// newRing builds an empty placement, it must be called with p.mu held
+func (p *HttpPool) newRing() {
+	p.loads = nil
+	if p.opts.Placement != nil {
+		p.peers = p.opts.Placement()
+		return
+	}
+	ring := hash.New(p.opts.Replicas, p.opts.HashFn)
+	if p.opts.HashFn64 != nil {
+		ring = hash.New64(p.opts.Replicas, p.opts.HashFn64)
+	}
+	p.peers = ring
+	if p.opts.LoadEpsilon > 0 {
+		p.loads = hash.NewBounded(ring, p.opts.LoadEpsilon)
+		p.peers = p.loads
+	}
+}
+
+// addWeighted adds the peer with the weight if the placement supports it,
+// it must be called with p.mu held
+func (p *HttpPool) addWeighted(peer string, weight int) {
+	if wp, ok := p.peers.(hash.WeightedPlacement); ok {
+		wp.AddWeighted(peer, weight)
+		return
+	}
+	p.peers.Add(peer)
+}
+
+// weight returns the weight of the peer in the options
+func (p *HttpPool) weight(peer string) int {
+	if w, ok := p.opts.Weights[peer]; ok {
+		return w
+	}
+	return 1
+}
+
+// AddPeers adds the peers to the pool, the existing peers are kept,
+// and only the keys taken by the new peers change their owner
+func (p *HttpPool) AddPeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, peer := range peers {
+		p.addPeer(peer, p.weight(peer))
+	}
+}
+
+// AddWeightedPeer adds the peer which takes the keys in proportion to its weight,
+// the weight of an existing peer isn't changed
+func (p *HttpPool) AddWeightedPeer(peer string, weight int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.addPeer(peer, weight)
+}
+
+// addPeer adds the peer if it's not in the pool, it must be called with p.mu held
+func (p *HttpPool) addPeer(peer string, weight int) {
+	if p.peers == nil {
+		p.newRing()
+		p.httpGetter = make(map[string]*httpGetter)
+	}
+	if _, ok := p.httpGetter[peer]; ok {
+		return
+	}
+	p.addWeighted(peer, weight)
+	p.httpGetter[peer] = p.getter(peer)
+}
+
+// RemovePeers removes the peers from the pool,
+// only the keys owned by them move to the next peers on the ring
+func (p *HttpPool) RemovePeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	op, ok := p.peers.(hash.OrderedPlacement)
+	appendOnly := ok && op.Ordered()
 	for _, peer := range peers {
-		p.httpGetter[peer] = &httpGetter{baseURL: peer + p.basePath}
+		if _, ok := p.httpGetter[peer]; !ok {
+			continue
+		}
+		// removing the node would change the buckets of the others
+		if !appendOnly {
+			p.peers.Remove(peer)
+		}
+		delete(p.httpGetter, peer)
+	}
+}
+
+// getter returns the existing httpGetter of the peer or a new one, it must be called with p.mu held
+func (p *HttpPool) getter(peer string) *httpGetter {
+	if getter, ok := p.httpGetter[peer]; ok {
+		return getter
 	}
+	return &httpGetter{baseURL: peer + p.basePath, peer: peer, pool: p}
 }
 
 // PickPeer get the correct node according to the key
+// the down peers are skipped, the key goes to the next node on the ring until they're up,
+// so are the full peers with the bounded loads
 func (p *HttpPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("Pick peer %s", peer)
-		return p.httpGetter[peer], true
+	if p.peers == nil {
+		p.mu.Unlock()
+		return nil, false
+	}
+	peer := p.peers.Lookup(key, func(node string) bool {
+		return p.serving(node) && (node == p.self || p.health.healthy(node))
+	})
+	getter := p.httpGetter[peer]
+	p.mu.Unlock()
+	if peer != "" && peer != p.self {
+		p.log().Debug("pick peer", "self", p.self, "key", key, "peer", peer)
+		return getter, true
 	}
 	return nil, false
 }
 
-var _ PeerPicker = (*HttpPool)(nil)
+// PickPeers returns the healthy owners of the key in order up to n, it stops at self
+func (p *HttpPool) PickPeers(key string, n int) ([]PeerGetter, bool) {
+	p.mu.Lock()
+	if p.peers == nil {
+		p.mu.Unlock()
+		return nil, false
+	}
+	var owners []string
+	self := false
+	p.peers.Lookup(key, func(node string) bool {
+		if !p.serving(node) {
+			return false
+		}
+		if node == p.self {
+			self = true
+			return true
+		}
+		if !p.health.healthy(node) || slices.Contains(owners, node) {
+			return false
+		}
+		owners = append(owners, node)
+		return len(owners) == n
+	})
+	getters := make([]PeerGetter, 0, len(owners))
+	for _, owner := range owners {
+		getters = append(getters, p.httpGetter[owner])
+	}
+	p.mu.Unlock()
+	p.log().Debug("pick peers", "self", p.self, "key", key, "peers", owners)
+	return getters, self
+}
+
+// startRequest counts an in-flight request to the peer for the bounded loads
+func (p *HttpPool) startRequest(peer string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.loads != nil {
+		p.loads.Inc(peer)
+	}
+}
+
+// doneRequest counts a done request to the peer for the bounded loads
+func (p *HttpPool) doneRequest(peer string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.loads != nil {
+		p.loads.Done(peer)
+	}
+}
+
+// GetAll returns the httpGetter of all peers except self
+func (p *HttpPool) GetAll() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	getters := make([]PeerGetter, 0, len(p.httpGetter))
+	for peer, getter := range p.httpGetter {
+		if peer != p.self {
+			getters = append(getters, getter)
+		}
+	}
+	return getters
+}
+
+var _ ReplicaPicker = (*HttpPool)(nil)
 
 // ServeHTTP handle all request
-// get the value by /<basePath>/<groupName>/<key>
+// get the value by GET /<basePath>/<groupName>/<key>
+// remove the key by DELETE /<basePath>/<groupName>/<key>
+// get the values of many keys by POST /<basePath> with a BatchRequest
+// ask for the load lease by POST /<basePath>_lease with a LeaseRequest
+// release the load lease by POST /<basePath>_release with a ReleaseRequest
+// probe the health by GET /<basePath>
+// get the metrics in the Prometheus text format by GET /metrics
 func (p *HttpPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == defaultMetricsPath {
+		p.serveMetrics(w, r)
+		return
+	}
 	// Check the path
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
 		panic("HttpPool serving unexpected path: " + r.URL.Path)
 	}
-	p.Log("%s %s", r.Method, r.URL.Path)
+	p.log().Debug("serve request", "self", p.self, "method", r.Method, "path", r.URL.Path)
+
+	if r.URL.Path == p.basePath {
+		switch r.Method {
+		case http.MethodPost:
+			p.serveBatch(w, r)
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.Error(w, "bad request", http.StatusBadRequest)
+		}
+		return
+	}
+	if r.Method == http.MethodPost {
+		switch r.URL.Path[len(p.basePath):] {
+		case leasePath:
+			p.serveLease(w, r)
+			return
+		case releasePath:
+			p.serveRelease(w, r)
+			return
+		}
+	}
 
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
 	if len(parts) != 2 {
@@ -82,7 +400,6 @@ func (p *HttpPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	groupName := parts[0]
 	key := parts[1]
-	fmt.Printf("try to get [group] %s [key] %s\n", groupName, key)
 
 	// get the according group
 	group := GetGroup(groupName)
@@ -90,16 +407,139 @@ func (p *HttpPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
 		return
 	}
+	group.stats.serverRequests.Add(1)
 
-	// get value of the key
-	view, err := group.Get(key)
+	// only remove the key in this peer, the sender has broadcast it to the others
+	if r.Method == http.MethodDelete {
+		group.localRemove(key)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// get value of the key, the sender has picked this peer, so it isn't routed again
+	view, err := group.Get(withForwarded(r.Context()), key)
+	if errors.Is(err, ErrNotFound) {
+		// not a failure of this peer, the sender mustn't load the key by itself
+		writeProto(w, &pb.Response{NotFound: true})
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// write value as response
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	resp := &pb.Response{Value: view.ByteSlice()}
+	if !view.Expire().IsZero() {
+		resp.Expire = view.Expire().UnixNano()
+	}
+	writeProto(w, resp)
+}
+
+// serveBatch loads all keys in the BatchRequest by Group.GetMany,
+// the error of every key is written in its KeyValue
+func (p *HttpPool) serveBatch(w http.ResponseWriter, r *http.Request) {
+	req := &pb.BatchRequest{}
+	if err := readProto(r, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	group := GetGroup(req.GetGroup())
+	if group == nil {
+		http.Error(w, "no such group: "+req.GetGroup(), http.StatusNotFound)
+		return
+	}
+	group.stats.serverRequests.Add(1)
+
+	views, errs := group.getMany(withForwarded(r.Context()), req.GetKeys())
+	resp := &pb.BatchResponse{Values: make([]*pb.KeyValue, 0, len(req.GetKeys()))}
+	for _, key := range req.GetKeys() {
+		kv := &pb.KeyValue{Key: key}
+		if err, ok := errs[key]; ok && errors.Is(err, ErrNotFound) {
+			kv.NotFound = true
+		} else if ok {
+			kv.Error = err.Error()
+		} else {
+			view := views[key]
+			kv.Value = view.ByteSlice()
+			if !view.Expire().IsZero() {
+				kv.Expire = view.Expire().UnixNano()
+			}
+		}
+		resp.Values = append(resp.Values, kv)
+	}
+	writeProto(w, resp)
+}
+
+// serveLease waits for the lease of the key in the LeaseRequest,
+// it answers with the lease or with the value loaded by the holder
+func (p *HttpPool) serveLease(w http.ResponseWriter, r *http.Request) {
+	req := &pb.LeaseRequest{}
+	if err := readProto(r, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group := GetGroup(req.GetGroup())
+	if group == nil {
+		http.Error(w, "no such group: "+req.GetGroup(), http.StatusNotFound)
+		return
+	}
+	group.stats.serverRequests.Add(1)
+
+	token, granted, view, err := group.leases.acquire(r.Context(), req.GetKey(), time.Duration(req.GetTtl()))
+	if errors.Is(err, ErrNotFound) {
+		writeProto(w, &pb.LeaseResponse{NotFound: true})
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	resp := &pb.LeaseResponse{Granted: granted, Token: token}
+	if !granted {
+		resp.Value = view.ByteSlice()
+		if !view.Expire().IsZero() {
+			resp.Expire = view.Expire().UnixNano()
+		}
+	}
+	writeProto(w, resp)
+}
+
+// serveRelease hands the result in the ReleaseRequest to the waiters of the lease
+func (p *HttpPool) serveRelease(w http.ResponseWriter, r *http.Request) {
+	req := &pb.ReleaseRequest{}
+	if err := readProto(r, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group := GetGroup(req.GetGroup())
+	if group == nil {
+		http.Error(w, "no such group: "+req.GetGroup(), http.StatusNotFound)
+		return
+	}
+	group.stats.serverRequests.Add(1)
+
+	err := errorFromPeer(req.GetError())
+	if req.GetNotFound() {
+		err = notFoundError(req.GetKey())
+	}
+	group.leases.release(req.GetKey(), req.GetToken(), newPeerView(req.GetValue(), req.GetExpire()), err)
+	writeProto(w, &pb.Response{})
+}
+
+// readProto reads the message from the request body
+func readProto(r *http.Request, m proto.Message) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(body, m)
+}
+
+// writeProto writes the message as response
+func writeProto(w http.ResponseWriter, m proto.Message) {
+	body, err := proto.Marshal(m)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -114,28 +554,84 @@ func (p *HttpPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // httpGetter is a client
 type httpGetter struct {
 	baseURL string
+	// the name of the peer
+	peer string
+	// the pool records the latency of requests and provides the logger, optional
+	pool *HttpPool
 }
 
-func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
-	u := fmt.Sprintf("%v%v%v", h.baseURL, url.QueryEscape(in.GetGroup()),
+// log returns the logger of the pool
+func (h *httpGetter) log() *slog.Logger {
+	if h.pool == nil {
+		return slog.Default()
+	}
+	return h.pool.log()
+}
+
+// client returns the http client of the pool
+func (h *httpGetter) client() *http.Client {
+	if h.pool == nil {
+		return http.DefaultClient
+	}
+	return h.pool.opts.Client
+}
+
+// url returns the url of the key, e.g. http://localhost:8001/_fcache/scores/Tom
+func (h *httpGetter) url(in *pb.Request) string {
+	return fmt.Sprintf("%v%v/%v", h.baseURL, url.QueryEscape(in.GetGroup()),
 		url.QueryEscape(in.GetKey()))
+}
 
-	resp, err := http.Get(u)
+// do sends the request to the peer and returns the body of the response,
+// the request is cancelled with ctx
+func (h *httpGetter) do(ctx context.Context, method, u string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if h.pool != nil {
+		h.pool.startRequest(h.peer)
+		defer h.pool.doneRequest(h.peer)
+	}
+	defer func(start time.Time) {
+		latency := time.Since(start)
+		if h.pool != nil {
+			h.pool.metrics.observe(h.peer, method, latency)
+		}
+		h.log().Debug("peer request", "peer", h.peer, "method", method, "latency", latency)
+	}(time.Now())
+	resp, err := h.client().Do(req)
+	if err != nil {
+		// the request cancelled by the caller doesn't mean the peer is down
+		if h.pool != nil && ctx.Err() == nil {
+			h.pool.markFailure(h.peer, err)
+		}
+		return nil, err
+	}
+	if h.pool != nil {
+		h.pool.markSuccess(h.peer)
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			log.Printf("close body err %v\n", err)
+			h.log().Warn("close body failed", "peer", h.peer, "err", err)
 		}
 	}(resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", resp.Status)
+		return nil, fmt.Errorf("server returned: %v", resp.Status)
 	}
+	return io.ReadAll(resp.Body)
+}
 
-	bytes, err := io.ReadAll(resp.Body)
+// String returns the name of the peer
+func (h *httpGetter) String() string {
+	return h.peer
+}
+
+// Get sends GET to the peer
+func (h *httpGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	bytes, err := h.do(ctx, http.MethodGet, h.url(in), nil)
 	if err != nil {
 		return err
 	}
@@ -146,6 +642,58 @@ func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 	return nil
 }
 
+// Remove sends DELETE to the peer
+func (h *httpGetter) Remove(ctx context.Context, in *pb.Request) error {
+	_, err := h.do(ctx, http.MethodDelete, h.url(in), nil)
+	return err
+}
+
+// GetMany sends POST with all keys to the base path of the peer
+func (h *httpGetter) GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	resp, err := h.do(ctx, http.MethodPost, h.baseURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if err := proto.Unmarshal(resp, out); err != nil {
+		return fmt.Errorf("unmarshal response err %v", err)
+	}
+	return nil
+}
+
+// Lease sends POST with the LeaseRequest to the lease path of the peer,
+// it blocks until the lease is granted or the value is loaded by the holder
+func (h *httpGetter) Lease(ctx context.Context, in *pb.LeaseRequest, out *pb.LeaseResponse) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	resp, err := h.do(ctx, http.MethodPost, h.baseURL+leasePath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if err := proto.Unmarshal(resp, out); err != nil {
+		return fmt.Errorf("unmarshal response err %v", err)
+	}
+	return nil
+}
+
+// Release sends POST with the ReleaseRequest to the release path of the peer
+func (h *httpGetter) Release(ctx context.Context, in *pb.ReleaseRequest) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	_, err = h.do(ctx, http.MethodPost, h.baseURL+releasePath, bytes.NewReader(body))
+	return err
+}
+
 // To verify httpGetter has implemented PeerGetter
 // The statement is usually used to check the interface implement in the compile period
 var _ PeerGetter = (*httpGetter)(nil)
+var _ LeaseGetter = (*httpGetter)(nil)
@@ -0,0 +1,417 @@
+package fcache
+
+import (
+	"context"
+	"fmt"
+	pb "github.com/univero/fcache/fcache/cachepb"
+	"github.com/univero/fcache/fcache/hash"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHttpGetRemove(t *testing.T) {
+	g := NewGroup("http", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("key %s not found", key)
+		}))
+	defer g.Close()
+	server := NewHttpPool("self")
+	defer server.Close()
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	out := &pb.Response{}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "http", Key: "Tom"}, out); err != nil || string(out.Value) != "630" {
+		t.Fatal("failed to get the key from peer: Tom")
+	}
+	if err := g.Set("Tom", []byte("000"), time.Time{}); err != nil {
+		t.Fatal("failed to set the key: Tom")
+	}
+	if err := getter.Remove(context.Background(), &pb.Request{Group: "http", Key: "Tom"}); err != nil {
+		t.Fatal("failed to remove the key from peer: Tom")
+	}
+	if _, ok := g.mainCache.get("Tom"); ok {
+		t.Fatal("Tom should be removed by the peer request")
+	}
+}
+
+func TestHttpGetMany(t *testing.T) {
+	g := NewGroup("http-many", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("key %s not found", key)
+		}))
+	defer g.Close()
+	server := NewHttpPool("self")
+	defer server.Close()
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	out := &pb.BatchResponse{}
+	in := &pb.BatchRequest{Group: "http-many", Keys: []string{"Tom", "unknown"}}
+	if err := getter.GetMany(context.Background(), in, out); err != nil || len(out.Values) != 2 {
+		t.Fatalf("failed to get many keys from peer: %v", err)
+	}
+	if out.Values[0].GetKey() != "Tom" || string(out.Values[0].GetValue()) != "630" || out.Values[0].GetError() != "" {
+		t.Fatal("failed to get the key from peer: Tom")
+	}
+	if out.Values[1].GetError() == "" {
+		t.Fatal("the error of unknown should be carried")
+	}
+}
+
+func TestHttpNotFound(t *testing.T) {
+	g := NewGroup("http-not-found", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("key %s: %w", key, ErrNotFound)
+		}))
+	defer g.Close()
+	server := NewHttpPool("self")
+	defer server.Close()
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	out := &pb.Response{}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "http-not-found", Key: "unknown"}, out); err != nil || !out.GetNotFound() {
+		t.Fatalf("the not found should be carried rather than an error: %v", err)
+	}
+	batch := &pb.BatchResponse{}
+	in := &pb.BatchRequest{Group: "http-not-found", Keys: []string{"unknown"}}
+	if err := getter.GetMany(context.Background(), in, batch); err != nil || !batch.Values[0].GetNotFound() || batch.Values[0].GetError() != "" {
+		t.Fatalf("the not found of the key should be carried: %v", err)
+	}
+}
+
+// countingTransport counts the requests sent through it
+type countingTransport struct {
+	n atomic.Int64
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.n.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestHttpPoolOpts(t *testing.T) {
+	g := NewGroup("http-opts", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}))
+	defer g.Close()
+	mux := http.NewServeMux()
+	server := NewHttpPoolOpts("self", &HttpPoolOptions{BasePath: "/api/cache/"})
+	defer server.Close()
+	mux.Handle("/api/cache/", server)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	transport := &countingTransport{}
+	pool := NewHttpPoolOpts("client", &HttpPoolOptions{
+		BasePath:  "/api/cache/",
+		Replicas:  1,
+		HashFn:    func(data []byte) uint32 { return 0 },
+		Transport: transport,
+	})
+	defer pool.Close()
+	pool.Set(srv.URL)
+	peer, ok := pool.PickPeer("Tom")
+	if !ok {
+		t.Fatal("the key should be picked to the peer: Tom")
+	}
+	out := &pb.Response{}
+	if err := peer.Get(context.Background(), &pb.Request{Group: "http-opts", Key: "Tom"}, out); err != nil || string(out.Value) != "630" {
+		t.Fatalf("failed to get the key from peer under the base path: %v", err)
+	}
+	if transport.n.Load() != 1 {
+		t.Fatalf("the request should be sent through the transport, but %d requests got", transport.n.Load())
+	}
+}
+
+func TestAddRemovePeers(t *testing.T) {
+	pool := NewHttpPool("self")
+	defer pool.Close()
+	pool.AddPeers("self", "a", "b")
+	a := pool.httpGetter["a"]
+	owners := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = pool.peers.Get(key)
+	}
+
+	pool.AddPeers("a", "c")
+	if pool.httpGetter["a"] != a {
+		t.Fatal("the getter of the existing peer should be kept")
+	}
+	moved := 0
+	for key, owner := range owners {
+		if now := pool.peers.Get(key); now != owner {
+			if now != "c" {
+				t.Fatalf("the key %s should only move to the new peer, but it moves to %s", key, now)
+			}
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Fatal("some keys should move to the new peer")
+	}
+
+	pool.RemovePeers("c")
+	if _, ok := pool.httpGetter["c"]; ok {
+		t.Fatal("the getter of the removed peer should be dropped")
+	}
+	for key, owner := range owners {
+		if now := pool.peers.Get(key); now != owner {
+			t.Fatalf("the key %s should move back to %s, but %s got", key, owner, now)
+		}
+	}
+}
+
+func TestWeightedPeers(t *testing.T) {
+	// crc32 spreads the virtual nodes of the similar names poorly
+	pool := NewHttpPoolOpts("http://self:8001", &HttpPoolOptions{
+		HashFn64: hash.MixFNV64a,
+		Weights:  map[string]int{"http://big:8001": 3},
+	})
+	defer pool.Close()
+	pool.Set("http://self:8001", "http://big:8001")
+	pool.AddWeightedPeer("http://small:8001", 1)
+
+	const n = 50000
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[pool.peers.Get("key"+strconv.Itoa(i))]++
+	}
+	for node, weight := range map[string]int{"http://self:8001": 1, "http://big:8001": 3, "http://small:8001": 1} {
+		expect := float64(n) * float64(weight) / 5
+		if got := float64(counts[node]); got < expect*0.75 || got > expect*1.25 {
+			t.Errorf("%s should take about %.0f keys, but %.0f got", node, expect, got)
+		}
+	}
+}
+
+func TestBoundedLoadPeers(t *testing.T) {
+	pool := NewHttpPoolOpts("self", &HttpPoolOptions{LoadEpsilon: 0.25})
+	defer pool.Close()
+	pool.Set("self", "a", "b", "c")
+	// find a celebrity key owned by a peer
+	key, owner := "", ""
+	for i := 0; key == ""; i++ {
+		if peer, ok := pool.PickPeer(strconv.Itoa(i)); ok {
+			key, owner = strconv.Itoa(i), peer.(*httpGetter).peer
+		}
+	}
+
+	// the owner saturates with the in-flight requests of the celebrity key
+	for i := 0; i < 10; i++ {
+		pool.startRequest(owner)
+	}
+	if peer, ok := pool.PickPeer(key); ok && peer.(*httpGetter).peer == owner {
+		t.Fatal("the full peer should be skipped")
+	}
+	for i := 0; i < 10; i++ {
+		pool.doneRequest(owner)
+	}
+	if peer, ok := pool.PickPeer(key); !ok || peer.(*httpGetter).peer != owner {
+		t.Fatal("the key should go back to its peer after the requests are done")
+	}
+}
+
+func TestForwardedRequest(t *testing.T) {
+	// the full owner counts the requests routed back to it
+	var routedBack atomic.Int32
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routedBack.Add(1)
+	}))
+	defer owner.Close()
+
+	var pool *HttpPool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	pool = NewHttpPoolOpts(srv.URL, &HttpPoolOptions{LoadEpsilon: 0.25})
+	defer pool.Close()
+	pool.Set(srv.URL, owner.URL)
+
+	var loads atomic.Int32
+	g := NewGroup("forwarded", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads.Add(1)
+			return []byte(key), nil
+		}))
+	defer g.Close()
+	g.RegisterPeers(pool)
+
+	// find a key owned by the other peer, which is full in the sender's view
+	key := ""
+	for i := 0; key == ""; i++ {
+		if _, ok := pool.PickPeer(strconv.Itoa(i)); ok {
+			key = strconv.Itoa(i)
+		}
+	}
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	out := &pb.Response{}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "forwarded", Key: key}, out); err != nil || string(out.Value) != key {
+		t.Fatalf("failed to get the forwarded key: %v", err)
+	}
+	batch := &pb.BatchResponse{}
+	if err := getter.GetMany(context.Background(), &pb.BatchRequest{Group: "forwarded", Keys: []string{key + "0"}}, batch); err != nil {
+		t.Fatalf("failed to get the forwarded keys: %v", err)
+	}
+	if routedBack.Load() != 0 || loads.Load() != 2 {
+		t.Fatal("the forwarded requests should be served locally rather than routed back")
+	}
+}
+
+func TestPlacementPeers(t *testing.T) {
+	for name, placement := range map[string]func() hash.Placement{
+		"rendezvous": func() hash.Placement { return hash.NewRendezvous(nil) },
+		"jump":       func() hash.Placement { return hash.NewJump(nil) },
+		"maglev":     func() hash.Placement { return hash.NewMaglev(0, nil) },
+	} {
+		pool := NewHttpPoolOpts("self", &HttpPoolOptions{Placement: placement})
+		defer pool.Close()
+		pool.Set("self", "a", "b")
+		picked := make(map[string]bool)
+		for i := 0; i < 100; i++ {
+			if peer, ok := pool.PickPeer(strconv.Itoa(i)); ok {
+				picked[peer.(*httpGetter).peer] = true
+			}
+		}
+		if !picked["a"] || !picked["b"] {
+			t.Fatalf("the keys should be spread over the peers by %s, but %v got", name, picked)
+		}
+		pool.RemovePeers("a")
+		for i := 0; i < 100; i++ {
+			if peer, ok := pool.PickPeer(strconv.Itoa(i)); ok && peer.(*httpGetter).peer == "a" {
+				t.Fatalf("the removed peer shouldn't be picked by %s", name)
+			}
+		}
+	}
+}
+
+func TestPeerOrder(t *testing.T) {
+	// the jump depends on the order, it only suits the append-only membership
+	for name, placement := range map[string]func() hash.Placement{
+		"ring":       nil,
+		"rendezvous": func() hash.Placement { return hash.NewRendezvous(nil) },
+		"maglev":     func() hash.Placement { return hash.NewMaglev(0, nil) },
+	} {
+		a := NewHttpPoolOpts("a", &HttpPoolOptions{Placement: placement})
+		defer a.Close()
+		a.Set("a", "b", "c")
+		// the peers join and leave in another order, e.g. by gossip
+		b := NewHttpPoolOpts("b", &HttpPoolOptions{Placement: placement})
+		defer b.Close()
+		b.AddPeers("d", "c")
+		b.AddPeers("b", "a")
+		b.RemovePeers("d")
+		for i := 0; i < 1000; i++ {
+			key := strconv.Itoa(i)
+			if a.peers.Get(key) != b.peers.Get(key) {
+				t.Fatalf("the pools should agree on the owner of %s by %s", key, name)
+			}
+		}
+	}
+}
+
+// poolOwners returns the peer picked by the pool for every key, "" for self
+func poolOwners(pool *HttpPool, keys int) []string {
+	owners := make([]string, keys)
+	for i := range owners {
+		if peer, ok := pool.PickPeer("key" + strconv.Itoa(i)); ok {
+			owners[i] = peer.(*httpGetter).peer
+		}
+	}
+	return owners
+}
+
+// movedKeys returns the fraction of the keys whose owner changed
+func movedKeys(before, after []string) float64 {
+	moved := 0
+	for i := range before {
+		if before[i] != after[i] {
+			moved++
+		}
+	}
+	return float64(moved) / float64(len(before))
+}
+
+func TestPoolStability(t *testing.T) {
+	const n, keys = 10, 20000
+	for name, placement := range map[string]func() hash.Placement{
+		"ring":       nil,
+		"rendezvous": func() hash.Placement { return hash.NewRendezvous(nil) },
+		"jump":       func() hash.Placement { return hash.NewJump(nil) },
+		"maglev":     func() hash.Placement { return hash.NewMaglev(0, nil) },
+	} {
+		pool := NewHttpPoolOpts("self", &HttpPoolOptions{Placement: placement})
+		defer pool.Close()
+		nodes := make([]string, n+1)
+		for i := range nodes {
+			nodes[i] = fmt.Sprintf("http://10.0.0.%d:8001", i)
+		}
+		pool.AddPeers(nodes[:n]...)
+		before := poolOwners(pool, keys)
+		pool.AddPeers(nodes[n])
+		added := poolOwners(pool, keys)
+		// a peer in the middle, the jump would move two peers if it were really removed
+		pool.RemovePeers(nodes[n/2])
+		removed := poolOwners(pool, keys)
+		if slices.Contains(removed, nodes[n/2]) {
+			t.Fatalf("the removed peer shouldn't be picked by %s", name)
+		}
+
+		addMoved, removeMoved := movedKeys(before, added), movedKeys(added, removed)
+		t.Logf("%-10s moved %.3f on add, %.3f on remove", name, addMoved, removeMoved)
+		// the ideal is 1/(n+1) for both
+		if addMoved > 2.0/(n+1) || removeMoved > 2.0/(n+1) {
+			t.Errorf("%s moves too many keys: %.3f on add, %.3f on remove", name, addMoved, removeMoved)
+		}
+
+		pool.AddPeers(nodes[n/2])
+		if movedKeys(added, poolOwners(pool, keys)) != 0 {
+			t.Fatalf("the peer added again should take its keys back by %s", name)
+		}
+	}
+}
+
+func TestPickPeers(t *testing.T) {
+	pool := NewHttpPoolOpts("self", &HttpPoolOptions{Placement: func() hash.Placement { return hash.NewRendezvous(nil) }})
+	defer pool.Close()
+	pool.Set("self", "a", "b", "c")
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		peers, self := pool.PickPeers(key, 2)
+		primary, ok := pool.PickPeer(key)
+		if len(peers) == 0 {
+			if ok || !self {
+				t.Fatalf("no peer should be picked only if self is the primary of %s", key)
+			}
+			continue
+		}
+		if !ok || peers[0] != primary {
+			t.Fatalf("the first peer should be the primary of %s", key)
+		}
+		owners := len(peers)
+		if self {
+			owners++
+		}
+		if owners != 2 {
+			t.Fatalf("2 owners of %s should be picked, but %d peers and self %v got", key, len(peers), self)
+		}
+	}
+}
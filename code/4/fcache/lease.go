@@ -0,0 +1,202 @@
+package fcache
+
+import (
+	"context"
+	"errors"
+	pb "github.com/univero/fcache/fcache/cachepb"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultLeaseTTL is used if the LeaseRequest doesn't tell the ttl
+const defaultLeaseTTL = time.Second
+
+// A LeaseGetter is a PeerGetter which grants the leases to load the keys,
+// the Group with a load lease checks whether the peer implements it
+type LeaseGetter interface {
+	PeerGetter
+	// Lease waits until the lease of the key is granted or the value is loaded by the holder
+	Lease(ctx context.Context, in *pb.LeaseRequest, out *pb.LeaseResponse) error
+	// Release hands the result of the load to the callers waiting for the lease
+	Release(ctx context.Context, in *pb.ReleaseRequest) error
+}
+
+// lease is held by the peer which loads the key
+type lease struct {
+	token    uint64
+	deadline time.Time
+	// closed when the holder releases the lease
+	done  chan struct{}
+	value ByteView
+	err   error
+}
+
+// leaseTable grants the leases of the keys for which this peer is the coordinator
+type leaseTable struct {
+	mu    sync.Mutex
+	m     map[string]*lease
+	token uint64
+}
+
+// acquire grants the lease of the key if nobody holds it, otherwise it waits for the holder,
+// it returns the value or the not found error of the holder,
+// or the lease if the holder fails otherwise or the lease expires
+func (t *leaseTable) acquire(ctx context.Context, key string, ttl time.Duration) (token uint64, granted bool, value ByteView, err error) {
+	if ttl <= 0 {
+		ttl = defaultLeaseTTL
+	}
+	for {
+		t.mu.Lock()
+		l, ok := t.m[key]
+		if !ok || !time.Now().Before(l.deadline) {
+			if t.m == nil {
+				t.m = make(map[string]*lease)
+			}
+			t.token++
+			l = &lease{token: t.token, deadline: time.Now().Add(ttl), done: make(chan struct{})}
+			t.m[key] = l
+			t.mu.Unlock()
+			return l.token, true, ByteView{}, nil
+		}
+		t.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(l.deadline))
+		select {
+		case <-l.done:
+			timer.Stop()
+			if l.err == nil || errors.Is(l.err, ErrNotFound) {
+				return 0, false, l.value, l.err
+			}
+			// the holder failed, one of the waiters takes over the load
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, false, ByteView{}, ctx.Err()
+		}
+	}
+}
+
+// release hands the result to the waiters of the lease, it's ignored if the lease has expired,
+// the value is kept until the lease expires, so the peers falling back a bit later don't load it again
+func (t *leaseTable) release(key string, token uint64, value ByteView, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.m[key]
+	if !ok || l.token != token {
+		return
+	}
+	select {
+	case <-l.done:
+		// released twice
+		return
+	default:
+	}
+	l.value, l.err = value, err
+	close(l.done)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		delete(t.m, key)
+		return
+	}
+	time.AfterFunc(time.Until(l.deadline), func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.m[key] == l {
+			delete(t.m, key)
+		}
+	})
+}
+
+// loadWithLease loads the key locally after all owners of the key failed,
+// the coordinator of the key grants the lease to one peer, the others wait for its value,
+// so the peers falling back at the same time don't hit the getter all together
+func (g *Group) loadWithLease(ctx context.Context, key string, failed []PeerGetter) (ByteView, error) {
+	coord, self := g.leaseCoordinator(key, failed)
+	if coord == nil && !self {
+		return g.getLocally(ctx, key)
+	}
+
+	var (
+		token   uint64
+		granted bool
+		value   ByteView
+		err     error
+	)
+	if self {
+		token, granted, value, err = g.leases.acquire(ctx, key, g.leaseTTL)
+	} else {
+		resp := &pb.LeaseResponse{}
+		err = coord.Lease(ctx, &pb.LeaseRequest{Group: g.name, Key: key, Ttl: int64(g.leaseTTL)}, resp)
+		token, granted, value = resp.Token, resp.Granted, newPeerView(resp.Value, resp.Expire)
+		if resp.GetNotFound() {
+			err = notFoundError(key)
+		}
+	}
+	if errors.Is(err, ErrNotFound) {
+		if value, ok := g.notFoundView(); ok {
+			g.populateCache(key, value, &g.mainCache)
+		}
+		return ByteView{}, err
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ByteView{}, err
+		}
+		// the coordinator is unreachable as well, nothing protects the getter now
+		g.log().Warn("failed to get the load lease", "group", g.name, "key", key, "err", err)
+		return g.getLocally(ctx, key)
+	}
+	if !granted {
+		g.log().Debug("load from lease holder", "group", g.name, "key", key)
+		g.populateCache(key, value, &g.mainCache)
+		return value, nil
+	}
+
+	value, err = g.getLocally(ctx, key)
+	if self {
+		g.leases.release(key, token, value, err)
+		return value, err
+	}
+	req := &pb.ReleaseRequest{Group: g.name, Key: key, Token: token}
+	if errors.Is(err, ErrNotFound) {
+		req.NotFound = true
+	} else if err != nil {
+		req.Error = err.Error()
+	} else {
+		req.Value = value.ByteSlice()
+		if !value.Expire().IsZero() {
+			req.Expire = value.Expire().UnixNano()
+		}
+	}
+	// the waiters take over when the lease expires if the release is lost
+	if rerr := coord.Release(ctx, req); rerr != nil {
+		g.log().Warn("failed to release the load lease", "group", g.name, "key", key, "err", rerr)
+	}
+	return value, err
+}
+
+// leaseCoordinator returns the peer which grants the lease of the key,
+// it's the first owner of the key after the failed ones, self reports whether it's this peer
+func (g *Group) leaseCoordinator(key string, failed []PeerGetter) (coord LeaseGetter, self bool) {
+	rp, ok := g.peers.(ReplicaPicker)
+	if !ok {
+		return nil, false
+	}
+	peers, self := rp.PickPeers(key, len(failed)+1)
+	for _, peer := range peers {
+		if slices.Contains(failed, peer) {
+			continue
+		}
+		coord, _ = peer.(LeaseGetter)
+		return coord, false
+	}
+	return nil, self
+}
+
+// errorFromPeer rebuilds the error which a peer sent as a string
+func errorFromPeer(s string) error {
+	if s == "" {
+		return nil
+	}
+	return errors.New(s)
+}
@@ -0,0 +1,138 @@
+package fcache
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLeaseTable(t *testing.T) {
+	var leases leaseTable
+	ctx := context.Background()
+	token, granted, _, err := leases.acquire(ctx, "Tom", time.Second)
+	if err != nil || !granted {
+		t.Fatal("the first caller should get the lease")
+	}
+
+	done := make(chan ByteView)
+	go func() {
+		_, granted, view, err := leases.acquire(ctx, "Tom", time.Second)
+		if err != nil || granted {
+			t.Error("the second caller should wait for the holder")
+		}
+		done <- view
+	}()
+	time.Sleep(10 * time.Millisecond)
+	leases.release("Tom", token, ByteView{b: []byte("630")}, nil)
+	if view := <-done; view.String() != "630" {
+		t.Fatalf("the waiter should get the value of the holder, but %s got", view.String())
+	}
+	if _, granted, view, _ := leases.acquire(ctx, "Tom", time.Second); granted || view.String() != "630" {
+		t.Fatal("the value should be kept until the lease expires")
+	}
+
+	// the holder fails
+	token, _, _, _ = leases.acquire(ctx, "Jack", time.Second)
+	go leases.release("Jack", token, ByteView{}, errors.New("db is down"))
+	if _, granted, _, _ := leases.acquire(ctx, "Jack", time.Second); !granted {
+		t.Fatal("the waiter should take over the lease if the holder fails")
+	}
+
+	// the holder goes away
+	leases.acquire(ctx, "Sam", 20*time.Millisecond)
+	if _, granted, _, _ := leases.acquire(ctx, "Sam", time.Second); !granted {
+		t.Fatal("the waiter should take over the lease when it expires")
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, _, _, err := leases.acquire(cctx, "Sam", time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("the waiter should return when its ctx is done, but %v got", err)
+	}
+}
+
+// loadConcurrently loads the key with the lease from n callers at once,
+// the local singleflight is bypassed as if they're on different peers
+func loadConcurrently(g *Group, key string, owner PeerGetter, n int) []error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = g.loadWithLease(context.Background(), key, []PeerGetter{owner})
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// newLeaseGroup builds a group with the load lease, whose getter is slow and counts the loads
+func newLeaseGroup(name string, loads *atomic.Int32, peers PeerPicker) *Group {
+	g := NewGroup(name, 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads.Add(1)
+			time.Sleep(20 * time.Millisecond)
+			return []byte(key), nil
+		}), WithLoadLease(time.Second))
+	g.RegisterPeers(peers)
+	return g
+}
+
+func TestLoadLease(t *testing.T) {
+	server := NewHttpPool("coordinator")
+	defer server.Close()
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+	owner := &fakePeer{down: true}
+	coordinator := &httpGetter{baseURL: srv.URL + defaultBasePath, peer: srv.URL}
+
+	// the coordinator is the next owner
+	var loads atomic.Int32
+	g := newLeaseGroup("lease", &loads, &leasePicker{fakePicker: fakePicker{peer: owner}, owners: []PeerGetter{owner, coordinator}})
+	defer g.Close()
+	for _, err := range loadConcurrently(g, "Tom", owner, 5) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if loads.Load() != 1 {
+		t.Fatalf("only the holder of the lease should load the key, but it's loaded %d times", loads.Load())
+	}
+
+	// this peer is the coordinator
+	loads.Store(0)
+	g = newLeaseGroup("lease-self", &loads, &fakeReplicaPicker{fakePicker: fakePicker{peer: owner}, replicas: []*fakePeer{owner}, self: true})
+	defer g.Close()
+	for _, err := range loadConcurrently(g, "Tom", owner, 5) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if loads.Load() != 1 {
+		t.Fatalf("only the holder of the lease should load the key, but it's loaded %d times", loads.Load())
+	}
+
+	// there is no coordinator after the owner, every caller loads the key
+	loads.Store(0)
+	g = newLeaseGroup("lease-none", &loads, &fakeReplicaPicker{fakePicker: fakePicker{peer: owner}, replicas: []*fakePeer{owner}})
+	defer g.Close()
+	loadConcurrently(g, "Tom", owner, 5)
+	if loads.Load() != 5 {
+		t.Fatalf("the key should be loaded without the lease, but it's loaded %d times", loads.Load())
+	}
+}
+
+// leasePicker picks the owners in order for every key
+type leasePicker struct {
+	fakePicker
+	owners []PeerGetter
+}
+
+func (p *leasePicker) PickPeers(key string, n int) ([]PeerGetter, bool) {
+	return p.owners[:min(n, len(p.owners))], false
+}
@@ -0,0 +1,223 @@
+package lru
+
+import (
+	"container/list"
+	"time"
+)
+
+type (
+	// ARCCache realises the Adaptive Replacement Cache
+	// t1 keeps the entries visited once recently, t2 keeps the entries visited at least twice
+	// b1 and b2 are the ghost lists of t1 and t2, they only remember the evicted keys and sizes,
+	// a hit in the ghost list moves the target size p of t1 to adapt to the workload,
+	// so a scan of one-off keys only flushes t1 and the hot set in t2 survives
+	// all sizes are counted in bytes instead of the number of entries
+	ARCCache struct {
+		maxBytes int64
+		// the target bytes of t1
+		p              int64
+		t1, t2, b1, b2 *arcList
+		OnEvicted      func(key string, value Value)
+	}
+
+	// arcList is a list with the index and the bytes of its entries
+	arcList struct {
+		ll     *list.List
+		cache  map[string]*list.Element
+		nbytes int64
+	}
+
+	// arcEntry the type of node in the arc lists, value is nil in the ghost lists
+	arcEntry struct {
+		key   string
+		value Value
+		size  int64
+		// the zero time means never expire
+		expire time.Time
+	}
+)
+
+func newArcList() *arcList {
+	return &arcList{ll: list.New(), cache: make(map[string]*list.Element)}
+}
+
+func (l *arcList) pushFront(e *arcEntry) {
+	l.cache[e.key] = l.ll.PushFront(e)
+	l.nbytes += e.size
+}
+
+func (l *arcList) remove(ele *list.Element) *arcEntry {
+	e := l.ll.Remove(ele).(*arcEntry)
+	delete(l.cache, e.key)
+	l.nbytes -= e.size
+	return e
+}
+
+func (l *arcList) removeBack() *arcEntry {
+	if ele := l.ll.Back(); ele != nil {
+		return l.remove(ele)
+	}
+	return nil
+}
+
+var _ Policy = (*ARCCache)(nil)
+
+// NewARC Initialise the ARC cache
+func NewARC(maxBytes int64, onEvicted func(string, Value)) *ARCCache {
+	return &ARCCache{
+		maxBytes:  maxBytes,
+		t1:        newArcList(),
+		t2:        newArcList(),
+		b1:        newArcList(),
+		b2:        newArcList(),
+		OnEvicted: onEvicted,
+	}
+}
+
+// Get retrieve the value and ok, a hit entry is promoted to the front of t2
+func (c *ARCCache) Get(key string) (value Value, ok bool) {
+	if ele, ok := c.t1.cache[key]; ok {
+		if c.removeIfExpired(c.t1, ele, time.Now()) {
+			return nil, false
+		}
+		e := c.t1.remove(ele)
+		c.t2.pushFront(e)
+		return e.value, true
+	}
+	if ele, ok := c.t2.cache[key]; ok {
+		if c.removeIfExpired(c.t2, ele, time.Now()) {
+			return nil, false
+		}
+		c.t2.ll.MoveToFront(ele)
+		return ele.Value.(*arcEntry).value, true
+	}
+	return
+}
+
+// Remove discard the entry of the key if it exists
+func (c *ARCCache) Remove(key string) {
+	if ele, ok := c.t1.cache[key]; ok {
+		c.removeResident(c.t1, ele)
+	} else if ele, ok := c.t2.cache[key]; ok {
+		c.removeResident(c.t2, ele)
+	}
+}
+
+// removeResident discard the entry without remembering it in the ghost list,
+// because an expired or removed entry tells nothing about the workload
+func (c *ARCCache) removeResident(l *arcList, ele *list.Element) {
+	e := l.remove(ele)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// removeIfExpired discard the entry if it's expired
+func (c *ARCCache) removeIfExpired(l *arcList, ele *list.Element, now time.Time) bool {
+	if !expired(ele.Value.(*arcEntry).expire, now) {
+		return false
+	}
+	c.removeResident(l, ele)
+	return true
+}
+
+// RemoveOldest discard an entry of t1 or t2 according to the target p
+func (c *ARCCache) RemoveOldest() {
+	c.replace(false)
+}
+
+// replace evicts the LRU entry of t1 or t2 into its ghost list
+// inB2 reports whether the key being added was found in b2
+func (c *ARCCache) replace(inB2 bool) {
+	var e *arcEntry
+	if c.t1.ll.Len() > 0 && (c.t1.nbytes > c.p || (inB2 && c.t1.nbytes == c.p) || c.t2.ll.Len() == 0) {
+		e = c.t1.removeBack()
+		c.b1.pushFront(&arcEntry{key: e.key, size: e.size})
+	} else if e = c.t2.removeBack(); e != nil {
+		c.b2.pushFront(&arcEntry{key: e.key, size: e.size})
+	}
+	if e == nil {
+		return
+	}
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// Add adds a value to the cache, it never expires
+func (c *ARCCache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds a value to the cache
+func (c *ARCCache) AddWithExpire(key string, value Value, expire time.Time) {
+	size := int64(len(key)) + int64(value.Len())
+	inB2 := false
+	if ele, ok := c.t1.cache[key]; ok {
+		// the second visit, promote it to t2
+		c.t1.remove(ele)
+		c.t2.pushFront(&arcEntry{key, value, size, expire})
+	} else if ele, ok := c.t2.cache[key]; ok {
+		c.t2.remove(ele)
+		c.t2.pushFront(&arcEntry{key, value, size, expire})
+	} else if ele, ok := c.b1.cache[key]; ok {
+		// recently evicted from t1, so t1 should be larger
+		delta := size
+		if c.b1.nbytes > 0 && c.b1.nbytes < c.b2.nbytes {
+			delta = size * c.b2.nbytes / c.b1.nbytes
+		}
+		c.p = min(c.p+delta, c.maxBytes)
+		c.b1.remove(ele)
+		c.t2.pushFront(&arcEntry{key, value, size, expire})
+	} else if ele, ok := c.b2.cache[key]; ok {
+		// recently evicted from t2, so t2 should be larger
+		delta := size
+		if c.b2.nbytes > 0 && c.b2.nbytes < c.b1.nbytes {
+			delta = size * c.b1.nbytes / c.b2.nbytes
+		}
+		c.p = max(c.p-delta, 0)
+		c.b2.remove(ele)
+		c.t2.pushFront(&arcEntry{key, value, size, expire})
+		inB2 = true
+	} else {
+		c.t1.pushFront(&arcEntry{key, value, size, expire})
+	}
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.maxBytes < c.t1.nbytes+c.t2.nbytes {
+		c.replace(inB2)
+	}
+	// the ghost lists remember at most maxBytes of history each
+	for c.b1.ll.Len() > 0 && c.maxBytes < c.t1.nbytes+c.b1.nbytes {
+		c.b1.removeBack()
+	}
+	for c.b2.ll.Len() > 0 && c.maxBytes < c.t2.nbytes+c.b2.nbytes {
+		c.b2.removeBack()
+	}
+}
+
+// RemoveExpired discard all expired entries and returns the number of them
+func (c *ARCCache) RemoveExpired() int {
+	now, n := time.Now(), 0
+	for _, l := range []*arcList{c.t1, c.t2} {
+		for ele := l.ll.Back(); ele != nil; {
+			prev := ele.Prev()
+			if c.removeIfExpired(l, ele, now) {
+				n++
+			}
+			ele = prev
+		}
+	}
+	return n
+}
+
+// Len the number of cache entries, the ghost entries are not counted
+func (c *ARCCache) Len() int {
+	return c.t1.ll.Len() + c.t2.ll.Len()
+}
+
+// Bytes the number of bytes has been used, the ghost entries are not counted
+func (c *ARCCache) Bytes() int64 {
+	return c.t1.nbytes + c.t2.nbytes
+}
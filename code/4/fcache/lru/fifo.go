@@ -0,0 +1,104 @@
+package lru
+
+import (
+	"container/list"
+	"time"
+)
+
+// FIFOCache always discards the entry which is added firstly,
+// visiting an entry doesn't change its position
+type FIFOCache struct {
+	maxBytes int64
+	nbytes   int64
+	// the front is the newest one, and the back is the oldest one
+	ll        *list.List
+	cache     map[string]*list.Element
+	OnEvicted func(key string, value Value)
+}
+
+var _ Policy = (*FIFOCache)(nil)
+
+// NewFIFO Initialise the FIFO cache
+func NewFIFO(maxBytes int64, onEvicted func(string, Value)) *FIFOCache {
+	return &FIFOCache{
+		maxBytes:  maxBytes,
+		ll:        list.New(),
+		cache:     make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+}
+
+// Get retrieve the value and ok without changing the order
+func (c *FIFOCache) Get(key string) (value Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		if expired(kv.expire, time.Now()) {
+			c.removeElement(ele)
+			return nil, false
+		}
+		return kv.value, true
+	}
+	return
+}
+
+// Remove discard the entry of the key if it exists
+func (c *FIFOCache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// RemoveOldest discard the first added entry
+func (c *FIFOCache) RemoveOldest() {
+	ele := c.ll.Back()
+	if ele != nil {
+		c.removeElement(ele)
+	}
+}
+
+// removeElement discard the entry of the element
+func (c *FIFOCache) removeElement(ele *list.Element) {
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// Add adds a value to the cache, it never expires
+func (c *FIFOCache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds a value to the cache, updating an existing key keeps its position
+func (c *FIFOCache) AddWithExpire(key string, value Value, expire time.Time) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
+		kv.value = value
+		kv.expire = expire
+	} else {
+		c.cache[key] = c.ll.PushFront(&entry{key, value, expire})
+		c.nbytes += int64(len(key)) + int64(value.Len())
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+// RemoveExpired discard all expired entries and returns the number of them
+func (c *FIFOCache) RemoveExpired() int {
+	return removeExpired(c.ll, c.removeElement)
+}
+
+// Len the number of cache entries
+func (c *FIFOCache) Len() int {
+	return c.ll.Len()
+}
+
+// Bytes the number of bytes has been used
+func (c *FIFOCache) Bytes() int64 {
+	return c.nbytes
+}
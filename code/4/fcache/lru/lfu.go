@@ -0,0 +1,168 @@
+package lru
+
+import (
+	"container/heap"
+	"time"
+)
+
+type (
+	// LFUCache discards the entry with the least visit count,
+	// when the counts are equal, the least recently used one is discarded
+	LFUCache struct {
+		maxBytes  int64
+		nbytes    int64
+		pq        lfuHeap
+		cache     map[string]*lfuEntry
+		OnEvicted func(key string, value Value)
+		// a logical clock, to break the tie of the same frequency
+		tick uint64
+	}
+
+	// lfuEntry the type of node in the heap
+	lfuEntry struct {
+		key   string
+		value Value
+		freq  uint64
+		// the zero time means never expire
+		expire time.Time
+		// the last time the entry is visited
+		tick uint64
+		// index in the heap, maintained by the heap.Interface
+		index int
+	}
+
+	// lfuHeap is a min heap ordered by freq and then tick
+	lfuHeap []*lfuEntry
+)
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq == h[j].freq {
+		return h[i].tick < h[j].tick
+	}
+	return h[i].freq < h[j].freq
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x any) {
+	e := x.(*lfuEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
+
+var _ Policy = (*LFUCache)(nil)
+
+// NewLFU Initialise the LFU cache
+func NewLFU(maxBytes int64, onEvicted func(string, Value)) *LFUCache {
+	return &LFUCache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*lfuEntry),
+		OnEvicted: onEvicted,
+	}
+}
+
+// touch increases the frequency of the entry and fix its position
+func (c *LFUCache) touch(e *lfuEntry) {
+	c.tick++
+	e.freq++
+	e.tick = c.tick
+	heap.Fix(&c.pq, e.index)
+}
+
+// Get retrieve the value and ok, the frequency of the key is increased
+func (c *LFUCache) Get(key string) (value Value, ok bool) {
+	if e, ok := c.cache[key]; ok {
+		if expired(e.expire, time.Now()) {
+			c.removeEntry(e)
+			return nil, false
+		}
+		c.touch(e)
+		return e.value, true
+	}
+	return
+}
+
+// Remove discard the entry of the key if it exists
+func (c *LFUCache) Remove(key string) {
+	if e, ok := c.cache[key]; ok {
+		c.removeEntry(e)
+	}
+}
+
+// RemoveOldest discard the least frequently used entry
+func (c *LFUCache) RemoveOldest() {
+	if c.pq.Len() > 0 {
+		c.removeEntry(c.pq[0])
+	}
+}
+
+// removeEntry discard the entry from the heap and the map
+func (c *LFUCache) removeEntry(e *lfuEntry) {
+	heap.Remove(&c.pq, e.index)
+	delete(c.cache, e.key)
+	c.nbytes -= int64(len(e.key)) + int64(e.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// Add adds a value to the cache, it never expires
+func (c *LFUCache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds a value to the cache, updating an existing key counts as a visit
+func (c *LFUCache) AddWithExpire(key string, value Value, expire time.Time) {
+	if e, ok := c.cache[key]; ok {
+		c.nbytes += int64(value.Len()) - int64(e.value.Len())
+		e.value = value
+		e.expire = expire
+		c.touch(e)
+	} else {
+		c.tick++
+		e := &lfuEntry{key: key, value: value, freq: 1, expire: expire, tick: c.tick}
+		heap.Push(&c.pq, e)
+		c.cache[key] = e
+		c.nbytes += int64(len(key)) + int64(value.Len())
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+// RemoveExpired discard all expired entries and returns the number of them
+func (c *LFUCache) RemoveExpired() int {
+	now, n := time.Now(), 0
+	for _, e := range c.cache {
+		if expired(e.expire, now) {
+			c.removeEntry(e)
+			n++
+		}
+	}
+	return n
+}
+
+// Len the number of cache entries
+func (c *LFUCache) Len() int {
+	return c.pq.Len()
+}
+
+// Bytes the number of bytes has been used
+func (c *LFUCache) Bytes() int64 {
+	return c.nbytes
+}
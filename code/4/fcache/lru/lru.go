@@ -1,6 +1,9 @@
 package lru
 
-import "container/list"
+import (
+	"container/list"
+	"time"
+)
 
 type (
 	// Cache the main struct to manage the cache
@@ -23,6 +26,8 @@ type (
 	entry struct {
 		key   string
 		value Value
+		// the zero time means never expire
+		expire time.Time
 	}
 
 	// Value use Len to Count how many bytes it takes
@@ -31,6 +36,9 @@ type (
 	}
 )
 
+// To verify Cache has implemented Policy
+var _ Policy = (*Cache)(nil)
+
 // New Initialise the cache, set the maximum bytes can be used and extra function called when a entry evicted
 func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
 	return &Cache{
@@ -41,45 +49,67 @@ func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
 	}
 }
 
-// Get retrieve the value and ok
+// Get retrieve the value and ok, the expired entry is removed and treated as a miss
 func (c *Cache) Get(key string) (value Value, ok bool) {
 	if ele, ok := c.cache[key]; ok {
-		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
+		if expired(kv.expire, time.Now()) {
+			c.removeElement(ele)
+			return nil, false
+		}
+		c.ll.MoveToFront(ele)
 		return kv.value, true
 	}
 	return
 }
 
+// Remove discard the entry of the key if it exists
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
 // RemoveOldest discard the oldest entry
 func (c *Cache) RemoveOldest() {
 	ele := c.ll.Back()
 	if ele != nil {
-		// remove the entry from list
-		c.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		// remove the entry from map
-		delete(c.cache, kv.key)
-		// update the now bytes
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		// execute the optional OnEvicted if exist
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
-		}
+		c.removeElement(ele)
 	}
 }
 
-// Add adds a value to the cache
+// removeElement discard the entry of the element
+func (c *Cache) removeElement(ele *list.Element) {
+	// remove the entry from list
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	// remove the entry from map
+	delete(c.cache, kv.key)
+	// update the now bytes
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	// execute the optional OnEvicted if exist
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// Add adds a value to the cache, it never expires
 func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds a value to the cache, it's treated as a miss after expire
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
 	if ele, ok := c.cache[key]; ok {
 		// when the key exists, update it
 		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
 		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
 		kv.value = value
+		kv.expire = expire
 	} else {
 		// when the key is not existing, add it
-		ele := c.ll.PushFront(&entry{key, value})
+		ele := c.ll.PushFront(&entry{key, value, expire})
 		c.cache[key] = ele
 		c.nbytes += int64(len(key)) + int64(value.Len())
 	}
@@ -90,7 +120,17 @@ func (c *Cache) Add(key string, value Value) {
 	}
 }
 
+// RemoveExpired discard all expired entries and returns the number of them
+func (c *Cache) RemoveExpired() int {
+	return removeExpired(c.ll, c.removeElement)
+}
+
 // Len the number of cache entries
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+// Bytes the number of bytes has been used
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
@@ -0,0 +1,98 @@
+package lru
+
+import (
+	"container/list"
+	"time"
+)
+
+// Policy is the eviction strategy used by the cache
+// every implement counts both the length of key and value by Value.Len,
+// and calls OnEvicted when an entry is purged to keep the byte constraint or expired
+type Policy interface {
+	// Get retrieve the value and ok
+	Get(key string) (value Value, ok bool)
+	// Add adds a value to the cache, evicting entries when maxBytes is exceeded
+	Add(key string, value Value)
+	// AddWithExpire adds a value which is treated as a miss after expire,
+	// the zero time means never expire
+	AddWithExpire(key string, value Value, expire time.Time)
+	// RemoveExpired discard all expired entries and returns the number of them
+	RemoveExpired() int
+	// Remove discard the entry of the key if it exists
+	Remove(key string)
+	// RemoveOldest discard the entry chosen by the policy
+	RemoveOldest()
+	// Len the number of cache entries
+	Len() int
+	// Bytes the number of bytes has been used
+	Bytes() int64
+}
+
+// PolicyType marks which eviction strategy is used
+type PolicyType int
+
+const (
+	// LRU discards the least recently used entry, it's the default one
+	LRU PolicyType = iota
+	// LFU discards the least frequently used entry
+	LFU
+	// FIFO discards the oldest added entry
+	FIFO
+	// ARC balances the recency and the frequency adaptively
+	ARC
+	// TinyLFU admits an entry into the main area only if it's more frequent than the victim
+	TinyLFU
+)
+
+// String returns the name of the policy
+func (t PolicyType) String() string {
+	switch t {
+	case LRU:
+		return "lru"
+	case LFU:
+		return "lfu"
+	case FIFO:
+		return "fifo"
+	case ARC:
+		return "arc"
+	case TinyLFU:
+		return "tinylfu"
+	}
+	return "unknown"
+}
+
+// NewPolicy initialise the cache with the given eviction strategy
+// unknown type falls back to LRU
+func NewPolicy(t PolicyType, maxBytes int64, onEvicted func(string, Value)) Policy {
+	switch t {
+	case LFU:
+		return NewLFU(maxBytes, onEvicted)
+	case FIFO:
+		return NewFIFO(maxBytes, onEvicted)
+	case ARC:
+		return NewARC(maxBytes, onEvicted)
+	case TinyLFU:
+		return NewTinyLFU(maxBytes, onEvicted)
+	default:
+		return New(maxBytes, onEvicted)
+	}
+}
+
+// expired reports whether the expire time has passed, the zero time means never expire
+func expired(expire time.Time, now time.Time) bool {
+	return !expire.IsZero() && !now.Before(expire)
+}
+
+// removeExpired walks the list of *entry and removes the expired ones by remove
+func removeExpired(ll *list.List, remove func(*list.Element)) int {
+	now, n := time.Now(), 0
+	for ele := ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		if expired(ele.Value.(*entry).expire, now) {
+			remove(ele)
+			n++
+		}
+		ele = prev
+	}
+	return n
+}
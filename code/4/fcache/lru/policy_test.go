@@ -0,0 +1,232 @@
+package lru
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var policies = []PolicyType{LRU, LFU, FIFO, ARC, TinyLFU}
+
+// test the byte accounting and the callback are the same under every policy
+func TestPolicyOnEvicted(t *testing.T) {
+	for _, pt := range policies {
+		t.Run(pt.String(), func(t *testing.T) {
+			evicted := 0
+			p := NewPolicy(pt, int64(20), func(key string, value Value) {
+				evicted += len(key) + value.Len()
+			})
+			total := 0
+			for i := 0; i < 10; i++ {
+				k := "k" + strconv.Itoa(i)
+				p.Add(k, String("vv"))
+				total += len(k) + 2
+			}
+			if p.Len() != 5 || p.Bytes() != 20 {
+				t.Fatalf("expect 5 entries of 20 bytes, but %d entries of %d bytes got", p.Len(), p.Bytes())
+			}
+			if evicted != total-20 {
+				t.Fatalf("expect %d bytes evicted, but %d got", total-20, evicted)
+			}
+		})
+	}
+}
+
+// test updating a key changes its bytes instead of adding a new entry
+func TestPolicyUpdate(t *testing.T) {
+	for _, pt := range policies {
+		t.Run(pt.String(), func(t *testing.T) {
+			p := NewPolicy(pt, int64(0), nil)
+			p.Add("key1", String("value1"))
+			p.Add("key1", String("v1"))
+			if v, ok := p.Get("key1"); !ok || string(v.(String)) != "v1" || p.Len() != 1 {
+				t.Fatalf("update key1 failed")
+			}
+		})
+	}
+}
+
+func TestFIFO(t *testing.T) {
+	fifo := NewFIFO(int64(12), nil)
+	fifo.Add("k1", String("v1"))
+	fifo.Add("k2", String("v2"))
+	fifo.Add("k3", String("v3"))
+	// visiting k1 doesn't save it
+	fifo.Get("k1")
+	fifo.Add("k4", String("v4"))
+	if _, ok := fifo.Get("k1"); ok {
+		t.Fatalf("k1 should be removed firstly")
+	}
+}
+
+func TestLFU(t *testing.T) {
+	keys := make([]string, 0)
+	lfu := NewLFU(int64(12), func(key string, value Value) {
+		keys = append(keys, key)
+	})
+	lfu.Add("k1", String("v1"))
+	lfu.Add("k2", String("v2"))
+	lfu.Add("k3", String("v3"))
+	lfu.Get("k1")
+	lfu.Get("k1")
+	lfu.Get("k3")
+	lfu.Add("k4", String("v4"))
+	lfu.Add("k5", String("v5"))
+	expect := []string{"k2", "k4"}
+	if !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("expect keys %s evicted, but %s got", expect, keys)
+	}
+}
+
+// test the hot set visited twice survives a scan of one-off keys
+func TestARCScanResistant(t *testing.T) {
+	arc := NewARC(int64(40), nil)
+	hot := []string{"h1", "h2", "h3"}
+	for _, k := range hot {
+		arc.Add(k, String("vv"))
+		arc.Get(k)
+	}
+	for i := 0; i < 100; i++ {
+		arc.Add("s"+strconv.Itoa(i), String("vv"))
+	}
+	for _, k := range hot {
+		if _, ok := arc.Get(k); !ok {
+			t.Fatalf("hot key %s is flushed by the scan", k)
+		}
+	}
+}
+
+// test a burst of one-off keys doesn't flush the popular keys
+func TestTinyLFUBurst(t *testing.T) {
+	tiny := NewTinyLFU(int64(1000), nil)
+	hot := make([]string, 0)
+	for i := 0; i < 50; i++ {
+		k := "h" + strconv.Itoa(i)
+		hot = append(hot, k)
+		tiny.Add(k, String("vvvvvvvvvv"))
+		for j := 0; j < 3; j++ {
+			tiny.Get(k)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		k := "b" + strconv.Itoa(i)
+		if _, ok := tiny.Get(k); !ok {
+			tiny.Add(k, String("vvvvvvvvvv"))
+		}
+	}
+	for _, k := range hot {
+		if _, ok := tiny.Get(k); !ok {
+			t.Fatalf("hot key %s is flushed by the burst", k)
+		}
+	}
+}
+
+// test a rejected candidate doesn't evict any victim
+func TestTinyLFUAdmit(t *testing.T) {
+	tiny := NewTinyLFU(int64(100), nil)
+	tiny.Add("a", String(strings.Repeat("v", 40)))
+	tiny.Add("b", String(strings.Repeat("v", 40)))
+	for i := 0; i < 8; i++ {
+		tiny.Get("b")
+	}
+	// c is more frequent than a but not than b, and it needs the room of both
+	for i := 0; i < 3; i++ {
+		tiny.Get("c")
+	}
+	tiny.Add("c", String(strings.Repeat("v", 69)))
+	if _, ok := tiny.Get("c"); ok {
+		t.Fatal("c should be rejected by b")
+	}
+	for _, k := range []string{"a", "b"} {
+		if _, ok := tiny.Get(k); !ok {
+			t.Fatalf("%s shouldn't be evicted for the rejected candidate", k)
+		}
+	}
+}
+
+// zipfTrace generates the keys following the Zipfian distribution
+func zipfTrace(n int) []string {
+	r := rand.New(rand.NewSource(1))
+	z := rand.NewZipf(r, 1.01, 1, 1<<16)
+	trace := make([]string, n)
+	for i := range trace {
+		trace[i] = strconv.FormatUint(z.Uint64(), 10)
+	}
+	return trace
+}
+
+// BenchmarkHitRatio compares the hit ratio of the policies on a Zipfian trace
+// the ratio is reported as the hit% metric
+func BenchmarkHitRatio(b *testing.B) {
+	trace := zipfTrace(1 << 20)
+	for _, pt := range policies {
+		b.Run(pt.String(), func(b *testing.B) {
+			p := NewPolicy(pt, int64(1<<14), nil)
+			hits, total := 0, 0
+			for i := 0; i < b.N; i++ {
+				k := trace[i%len(trace)]
+				if _, ok := p.Get(k); ok {
+					hits++
+				} else {
+					p.Add(k, String("vvvvvvvv"))
+				}
+				total++
+			}
+			b.ReportMetric(float64(hits)*100/float64(total), "hit%")
+		})
+	}
+}
+
+// test the expired entry is treated as a miss and its bytes are reclaimed
+func TestPolicyExpire(t *testing.T) {
+	for _, pt := range policies {
+		t.Run(pt.String(), func(t *testing.T) {
+			evicted := make([]string, 0)
+			p := NewPolicy(pt, int64(0), func(key string, value Value) {
+				evicted = append(evicted, key)
+			})
+			p.AddWithExpire("k1", String("v1"), time.Now().Add(-time.Second))
+			p.AddWithExpire("k2", String("v2"), time.Now().Add(-time.Second))
+			p.AddWithExpire("k3", String("v3"), time.Now().Add(time.Hour))
+			p.Add("k4", String("v4"))
+			if _, ok := p.Get("k1"); ok || p.Len() != 3 {
+				t.Fatalf("expired k1 should be a miss")
+			}
+			if n := p.RemoveExpired(); n != 1 || p.Len() != 2 {
+				t.Fatalf("expect 1 expired entry removed, but %d got", n)
+			}
+			if !reflect.DeepEqual([]string{"k1", "k2"}, evicted) {
+				t.Fatalf("expect k1 and k2 evicted, but %s got", evicted)
+			}
+			if _, ok := p.Get("k3"); !ok {
+				t.Fatalf("k3 shouldn't expire")
+			}
+		})
+	}
+}
+
+func TestPolicyRemove(t *testing.T) {
+	for _, pt := range policies {
+		t.Run(pt.String(), func(t *testing.T) {
+			evicted := make([]string, 0)
+			p := NewPolicy(pt, int64(0), func(key string, value Value) {
+				evicted = append(evicted, key)
+			})
+			p.Add("k1", String("v1"))
+			p.Add("k2", String("v2"))
+			p.Get("k2")
+			p.Remove("k1")
+			p.Remove("k2")
+			p.Remove("k3")
+			if _, ok := p.Get("k1"); ok || p.Len() != 0 {
+				t.Fatalf("k1 should be removed")
+			}
+			if !reflect.DeepEqual([]string{"k1", "k2"}, evicted) {
+				t.Fatalf("expect k1 and k2 evicted, but %s got", evicted)
+			}
+		})
+	}
+}
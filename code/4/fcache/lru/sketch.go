@@ -0,0 +1,80 @@
+package lru
+
+import "hash/fnv"
+
+const (
+	// sketchDepth the number of rows, each row uses a different hash
+	sketchDepth = 4
+	// sketchMaxCount the counters are saturated at it, like the 4 bits counter in the paper
+	sketchMaxCount = 15
+)
+
+// cmSketch is a count-min sketch to estimate the frequency of keys in a small memory
+// it halves all counters after a sample of increments, so that the old popular keys fade out
+type cmSketch struct {
+	rows [sketchDepth][]uint8
+	mask uint64
+	// the number of increments since the last reset
+	additions int
+	// sampleSize the number of increments to trigger the reset
+	sampleSize int
+}
+
+// newCmSketch initialise a sketch which can count about width keys
+// width is rounded up to a power of two
+func newCmSketch(width int) *cmSketch {
+	n := 16
+	for n < width {
+		n <<= 1
+	}
+	s := &cmSketch{mask: uint64(n - 1), sampleSize: 10 * n}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, n)
+	}
+	return s
+}
+
+// indexes computes the position of key in every row by double hashing
+func (s *cmSketch) indexes(key string) [sketchDepth]uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	var idx [sketchDepth]uint64
+	for i := range idx {
+		idx[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return idx
+}
+
+// Increment records a visit of key
+func (s *cmSketch) Increment(key string) {
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < sketchMaxCount {
+			s.rows[i][j]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// Estimate returns the estimated frequency of key, the minimum counter of all rows
+func (s *cmSketch) Estimate(key string) uint8 {
+	var est uint8 = sketchMaxCount
+	for i, j := range s.indexes(key) {
+		est = min(est, s.rows[i][j])
+	}
+	return est
+}
+
+// reset halves all counters to age the history
+func (s *cmSketch) reset() {
+	for _, row := range s.rows {
+		for j := range row {
+			row[j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,251 @@
+package lru
+
+import (
+	"container/list"
+	"time"
+)
+
+const (
+	// windowPercent the percent of bytes used by the LRU window
+	windowPercent = 1
+	// protectedPercent the percent of the main area bytes used by the protected segment
+	protectedPercent = 80
+	// sketchEntryBytes the assumed average size of an entry to size the sketch
+	sketchEntryBytes = 64
+	// minSketchWidth the minimum number of counters in every row of the sketch
+	minSketchWidth = 1024
+)
+
+// tinyLFU segments, each entry knows where it is
+const (
+	windowSegment = iota
+	probationSegment
+	protectedSegment
+)
+
+type (
+	// TinyLFUCache realises the Window-TinyLFU
+	// a new entry is put in a small LRU window firstly, when it leaves the window
+	// it's admitted into the segmented LRU main area only if it's estimated more
+	// frequently used than the victim of the main area, the frequency is estimated by a count-min sketch,
+	// so a burst of one-off keys only flushes the window and the popular keys in the main area survive
+	TinyLFUCache struct {
+		maxBytes int64
+		// the bytes budget of the window and the protected segment
+		windowBytes, protectedBytes int64
+		// the main area is composed of probation and protected
+		window, probation, protected *tinyList
+		cache                        map[string]*list.Element
+		sketch                       *cmSketch
+		OnEvicted                    func(key string, value Value)
+	}
+
+	// tinyList is a LRU list with the bytes of its entries
+	tinyList struct {
+		ll     *list.List
+		nbytes int64
+	}
+
+	// tinyEntry the type of node in the lists
+	tinyEntry struct {
+		key     string
+		value   Value
+		segment int
+		// the zero time means never expire
+		expire time.Time
+	}
+)
+
+var _ Policy = (*TinyLFUCache)(nil)
+
+func (e *tinyEntry) size() int64 {
+	return int64(len(e.key)) + int64(e.value.Len())
+}
+
+// NewTinyLFU Initialise the W-TinyLFU cache
+func NewTinyLFU(maxBytes int64, onEvicted func(string, Value)) *TinyLFUCache {
+	mainBytes := maxBytes - maxBytes*windowPercent/100
+	return &TinyLFUCache{
+		maxBytes:       maxBytes,
+		windowBytes:    maxBytes * windowPercent / 100,
+		protectedBytes: mainBytes * protectedPercent / 100,
+		window:         &tinyList{ll: list.New()},
+		probation:      &tinyList{ll: list.New()},
+		protected:      &tinyList{ll: list.New()},
+		cache:          make(map[string]*list.Element),
+		sketch:         newCmSketch(max(int(maxBytes/sketchEntryBytes), minSketchWidth)),
+		OnEvicted:      onEvicted,
+	}
+}
+
+// list returns the list of the segment
+func (c *TinyLFUCache) list(segment int) *tinyList {
+	switch segment {
+	case windowSegment:
+		return c.window
+	case probationSegment:
+		return c.probation
+	default:
+		return c.protected
+	}
+}
+
+// move removes the entry from its list and pushes it to the front of the segment
+func (c *TinyLFUCache) move(ele *list.Element, segment int) {
+	e := ele.Value.(*tinyEntry)
+	from := c.list(e.segment)
+	from.ll.Remove(ele)
+	from.nbytes -= e.size()
+	e.segment = segment
+	to := c.list(segment)
+	c.cache[e.key] = to.ll.PushFront(e)
+	to.nbytes += e.size()
+}
+
+// onAccess maintain the order of a visited entry,
+// an entry in probation visited again is promoted to protected
+func (c *TinyLFUCache) onAccess(ele *list.Element) {
+	e := ele.Value.(*tinyEntry)
+	switch e.segment {
+	case probationSegment:
+		c.move(ele, protectedSegment)
+		// demote the least recently used protected entries
+		for c.protected.nbytes > c.protectedBytes && c.protected.ll.Len() > 1 {
+			c.move(c.protected.ll.Back(), probationSegment)
+		}
+	default:
+		c.list(e.segment).ll.MoveToFront(ele)
+	}
+}
+
+// Get retrieve the value and ok, every visit is recorded by the sketch
+func (c *TinyLFUCache) Get(key string) (value Value, ok bool) {
+	c.sketch.Increment(key)
+	if ele, ok := c.cache[key]; ok {
+		e := ele.Value.(*tinyEntry)
+		if expired(e.expire, time.Now()) {
+			c.remove(ele)
+			return nil, false
+		}
+		c.onAccess(ele)
+		return e.value, true
+	}
+	return
+}
+
+// remove discard the entry and call the OnEvicted
+func (c *TinyLFUCache) remove(ele *list.Element) {
+	e := ele.Value.(*tinyEntry)
+	l := c.list(e.segment)
+	l.ll.Remove(ele)
+	l.nbytes -= e.size()
+	delete(c.cache, e.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// victim returns the entry to be evicted in the main area
+func (c *TinyLFUCache) victim() *list.Element {
+	if ele := c.probation.ll.Back(); ele != nil {
+		return ele
+	}
+	return c.protected.ll.Back()
+}
+
+// Remove discard the entry of the key if it exists
+func (c *TinyLFUCache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.remove(ele)
+	}
+}
+
+// RemoveOldest discard the victim of the main area, or the oldest one in the window if the main area is empty
+func (c *TinyLFUCache) RemoveOldest() {
+	if ele := c.victim(); ele != nil {
+		c.remove(ele)
+	} else if ele := c.window.ll.Back(); ele != nil {
+		c.remove(ele)
+	}
+}
+
+// Add adds a value to the cache, it never expires
+func (c *TinyLFUCache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds a value to the cache
+func (c *TinyLFUCache) AddWithExpire(key string, value Value, expire time.Time) {
+	c.sketch.Increment(key)
+	if ele, ok := c.cache[key]; ok {
+		e := ele.Value.(*tinyEntry)
+		c.list(e.segment).nbytes += int64(value.Len()) - int64(e.value.Len())
+		e.value = value
+		e.expire = expire
+		c.onAccess(ele)
+	} else {
+		e := &tinyEntry{key: key, value: value, segment: windowSegment, expire: expire}
+		c.cache[key] = c.window.ll.PushFront(e)
+		c.window.nbytes += e.size()
+	}
+	if c.maxBytes == 0 {
+		return
+	}
+	// the entries leaving the window are the candidates for the main area
+	for c.window.nbytes > c.windowBytes {
+		c.admit(c.window.ll.Back())
+	}
+	for c.maxBytes < c.window.nbytes+c.probation.nbytes+c.protected.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+// admit moves the candidate into probation if it's more frequent than all the victims it needs,
+// otherwise the candidate is discarded and the victims are kept
+func (c *TinyLFUCache) admit(candidate *list.Element) {
+	mainBytes := c.maxBytes - c.windowBytes
+	cand := candidate.Value.(*tinyEntry)
+	freq := c.sketch.Estimate(cand.key)
+	// the victims are taken in the order of victim(), the back of probation and then of protected
+	var victims []*list.Element
+	free := mainBytes - c.probation.nbytes - c.protected.nbytes
+	next := c.probation.ll.Back()
+	for free < cand.size() {
+		if next == nil && len(victims) == c.probation.ll.Len() {
+			next = c.protected.ll.Back()
+		}
+		if next == nil || c.sketch.Estimate(next.Value.(*tinyEntry).key) >= freq {
+			c.remove(candidate)
+			return
+		}
+		victims = append(victims, next)
+		free += next.Value.(*tinyEntry).size()
+		next = next.Prev()
+	}
+	for _, victim := range victims {
+		c.remove(victim)
+	}
+	c.move(candidate, probationSegment)
+}
+
+// RemoveExpired discard all expired entries and returns the number of them
+func (c *TinyLFUCache) RemoveExpired() int {
+	now, n := time.Now(), 0
+	for _, ele := range c.cache {
+		if expired(ele.Value.(*tinyEntry).expire, now) {
+			c.remove(ele)
+			n++
+		}
+	}
+	return n
+}
+
+// Len the number of cache entries
+func (c *TinyLFUCache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes the number of bytes has been used
+func (c *TinyLFUCache) Bytes() int64 {
+	return c.window.nbytes + c.probation.nbytes + c.protected.nbytes
+}
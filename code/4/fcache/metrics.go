@@ -0,0 +1,211 @@
+package fcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMetricsPath the path of the metrics in the Prometheus text format
+const defaultMetricsPath = "/metrics"
+
+// latencyBuckets the upper bounds in seconds of the peer request latency histogram
+var latencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram counts the observations in buckets, the Prometheus way
+type histogram struct {
+	mu sync.Mutex
+	// counts[i] is the number of observations <= latencyBuckets[i], not cumulative
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(latencyBuckets))}
+}
+
+// observe records a value
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i := sort.SearchFloat64s(latencyBuckets, v); i < len(latencyBuckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// write the histogram with the labels, the buckets are cumulative in the text format
+func (h *histogram) write(w io.Writer, name, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var cumulative uint64
+	for i, le := range latencyBuckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels,
+			strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+// peerMetrics keeps the latency histograms of the requests to the peers
+type peerMetrics struct {
+	mu      sync.Mutex
+	latency map[[2]string]*histogram
+}
+
+// observe records the latency of a request of method to peer
+func (m *peerMetrics) observe(peer, method string, d time.Duration) {
+	m.mu.Lock()
+	if m.latency == nil {
+		m.latency = make(map[[2]string]*histogram)
+	}
+	h, ok := m.latency[[2]string{peer, method}]
+	if !ok {
+		h = newHistogram()
+		m.latency[[2]string{peer, method}] = h
+	}
+	m.mu.Unlock()
+	h.observe(d.Seconds())
+}
+
+// write all histograms sorted by peer and method
+func (m *peerMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	keys := make([][2]string, 0, len(m.latency))
+	for k := range m.latency {
+		keys = append(keys, k)
+	}
+	m.mu.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] == keys[j][0] {
+			return keys[i][1] < keys[j][1]
+		}
+		return keys[i][0] < keys[j][0]
+	})
+
+	const name = "fcache_peer_request_duration_seconds"
+	writeHeader(w, name, "histogram", "Latency of the requests sent to the peers.")
+	for _, k := range keys {
+		m.mu.Lock()
+		h := m.latency[k]
+		m.mu.Unlock()
+		h.write(w, name, fmt.Sprintf("peer=\"%s\",method=\"%s\"", escapeLabel(k[0]), escapeLabel(k[1])))
+	}
+}
+
+// groupMetric is a metric read from the snapshot of a group
+type groupMetric struct {
+	name, typ, help string
+	value           func(s Stats) int64
+}
+
+var groupMetrics = []groupMetric{
+	{"fcache_gets_total", "counter", "Get requests of the group, including from peers.",
+		func(s Stats) int64 { return s.Gets }},
+	{"fcache_hits_total", "counter", "Get requests hit in the mainCache or the hotCache.",
+		func(s Stats) int64 { return s.CacheHits }},
+	{"fcache_misses_total", "counter", "Get requests missed in both caches.",
+		func(s Stats) int64 { return s.Gets - s.CacheHits }},
+	{"fcache_peer_loads_total", "counter", "Values loaded from the peers.",
+		func(s Stats) int64 { return s.PeerLoads }},
+	{"fcache_peer_errors_total", "counter", "Failed requests to the peers.",
+		func(s Stats) int64 { return s.PeerErrors }},
+	{"fcache_local_loads_total", "counter", "Values loaded by the getter.",
+		func(s Stats) int64 { return s.LocalLoads }},
+	{"fcache_local_load_errors_total", "counter", "Failed loads by the getter.",
+		func(s Stats) int64 { return s.LocalLoadErrs }},
+	{"fcache_loads_deduped_total", "counter", "Loads which share the result of the same key.",
+		func(s Stats) int64 { return s.LoadsDeduped }},
+	{"fcache_server_requests_total", "counter", "Requests served for the peers.",
+		func(s Stats) int64 { return s.ServerRequests }},
+}
+
+// cacheMetric is a metric read from the statistics of a cache
+type cacheMetric struct {
+	name, typ, help string
+	value           func(s CacheStats) int64
+}
+
+var cacheMetrics = []cacheMetric{
+	{"fcache_cache_bytes", "gauge", "Bytes used by the cache.",
+		func(s CacheStats) int64 { return s.Bytes }},
+	{"fcache_cache_items", "gauge", "Entries in the cache.",
+		func(s CacheStats) int64 { return s.Items }},
+	{"fcache_cache_gets_total", "counter", "Lookups of the cache.",
+		func(s CacheStats) int64 { return s.Gets }},
+	{"fcache_cache_hits_total", "counter", "Lookups hit in the cache.",
+		func(s CacheStats) int64 { return s.Hits }},
+	{"fcache_cache_evictions_total", "counter", "Entries evicted, expired or removed from the cache.",
+		func(s CacheStats) int64 { return s.Evictions }},
+}
+
+// writeMetrics writes the metrics of all groups and the peer requests in the Prometheus text format
+func writeMetrics(w io.Writer, peers *peerMetrics) {
+	mu.RLock()
+	gs := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		gs = append(gs, g)
+	}
+	mu.RUnlock()
+	sort.Slice(gs, func(i, j int) bool { return gs[i].name < gs[j].name })
+
+	stats := make([]Stats, len(gs))
+	for i, g := range gs {
+		stats[i] = g.Stats()
+	}
+	for _, m := range groupMetrics {
+		writeHeader(w, m.name, m.typ, m.help)
+		for i, g := range gs {
+			fmt.Fprintf(w, "%s{group=\"%s\"} %d\n", m.name, escapeLabel(g.name), m.value(stats[i]))
+		}
+	}
+
+	caches := []struct {
+		label string
+		which CacheType
+	}{{"main", MainCache}, {"hot", HotCache}}
+	cacheStats := make([][]CacheStats, len(gs))
+	for i, g := range gs {
+		for _, c := range caches {
+			cacheStats[i] = append(cacheStats[i], g.CacheStats(c.which))
+		}
+	}
+	for _, m := range cacheMetrics {
+		writeHeader(w, m.name, m.typ, m.help)
+		for i, g := range gs {
+			for j, c := range caches {
+				fmt.Fprintf(w, "%s{group=\"%s\",cache=\"%s\"} %d\n",
+					m.name, escapeLabel(g.name), c.label, m.value(cacheStats[i][j]))
+			}
+		}
+	}
+
+	if peers != nil {
+		peers.write(w)
+	}
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// escapeLabel escapes the backslash, double-quote and line feed in a label value
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// serveMetrics handles the request of the metrics
+func (p *HttpPool) serveMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w, &p.metrics)
+}
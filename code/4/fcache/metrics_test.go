@@ -0,0 +1,56 @@
+package fcache
+
+import (
+	"context"
+	"fmt"
+	pb "github.com/univero/fcache/fcache/cachepb"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	g := NewGroup("metrics", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("key %s not found", key)
+		}))
+	defer g.Close()
+	pool := NewHttpPool("self")
+	defer pool.Close()
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+	pool.Set(srv.URL)
+	out := &pb.Response{}
+	if err := pool.httpGetter[srv.URL].Get(context.Background(), &pb.Request{Group: "metrics", Key: "Tom"}, out); err != nil {
+		t.Fatal("failed to get the key from peer: Tom")
+	}
+	g.Get(context.Background(), "Tom")
+
+	resp, err := http.Get(srv.URL + defaultMetricsPath)
+	if err != nil {
+		t.Fatal("failed to get the metrics")
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, line := range []string{
+		"# TYPE fcache_gets_total counter",
+		`fcache_gets_total{group="metrics"} 2`,
+		`fcache_hits_total{group="metrics"} 1`,
+		`fcache_misses_total{group="metrics"} 1`,
+		`fcache_local_loads_total{group="metrics"} 1`,
+		`fcache_server_requests_total{group="metrics"} 1`,
+		`fcache_cache_items{group="metrics",cache="main"} 1`,
+		"# TYPE fcache_peer_request_duration_seconds histogram",
+		fmt.Sprintf(`fcache_peer_request_duration_seconds_bucket{peer="%s",method="GET",le="+Inf"} 1`, srv.URL),
+		fmt.Sprintf(`fcache_peer_request_duration_seconds_count{peer="%s",method="GET"} 1`, srv.URL),
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Fatalf("the metrics should contain %q", line)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package fcache
+
+import (
+	"github.com/univero/fcache/fcache/lru"
+	"log/slog"
+	"time"
+)
+
+// A GroupOption configures the Group built by NewGroup
+type GroupOption func(*Group)
+
+// WithPolicy sets the eviction strategy of the group's cache, LRU by default
+func WithPolicy(policy lru.PolicyType) GroupOption {
+	return func(g *Group) {
+		g.policy = policy
+	}
+}
+
+// WithHotCacheBytes sets the bytes taken from the cacheBytes for the hotCache,
+// the rest is used by the mainCache, zero disables the hotCache,
+// by default it's 1/8 of the cacheBytes once the peers are registered, and zero without the peers
+func WithHotCacheBytes(n int64) GroupOption {
+	return func(g *Group) {
+		g.hotCacheBytes = n
+		g.hotCacheSet = true
+	}
+}
+
+// WithShards splits the mainCache and the hotCache into n shards with their own locks,
+// the keys are distributed by hash and the cacheBytes is divided evenly across the shards,
+// more shards reduce the lock contention on a busy node
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.shards = n
+	}
+}
+
+// WithJanitor sets how often the expired entries are reclaimed, zero disables the janitor
+// the expired entries are still treated as misses without the janitor
+func WithJanitor(interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.janitorInterval = interval
+	}
+}
+
+// WithLogger sets the logger of the group, slog.Default() is used by default
+// the cache hits and the loads are logged at the debug level, the values are never logged
+func WithLogger(logger *slog.Logger) GroupOption {
+	return func(g *Group) {
+		g.logger = logger
+	}
+}
+
+// WithReplication sets the replication factor, the key is owned by n peers in order,
+// the load tries the primary and then the secondaries before loading locally,
+// and a secondary keeps the values of its keys in the mainCache,
+// it takes effect if the PeerPicker implements ReplicaPicker
+func WithReplication(n int) GroupOption {
+	return func(g *Group) {
+		g.replication = n
+	}
+}
+
+// WithLoadLease makes the peers ask the coordinator of a key for a lease before loading it by the getter
+// after all owners of the key failed, only the holder of the lease loads the key, the others wait
+// for its value up to the ttl, so a partial outage doesn't send every peer to the origin at once,
+// the coordinator is the next owner of the key, so the PeerPicker must implement ReplicaPicker
+func WithLoadLease(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.leaseTTL = ttl
+	}
+}
+
+// WithNegativeCache caches the keys which the getter doesn't find for the ttl,
+// the getter tells it by returning an error wrapping ErrNotFound,
+// the later Gets of the key return the not found error without calling the getter again
+func WithNegativeCache(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.negativeTTL = ttl
+	}
+}
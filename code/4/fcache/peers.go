@@ -1,15 +1,35 @@
 package fcache
 
-import pb "github.com/univero/fcache/fcache/cachepb"
+import (
+	"context"
+	pb "github.com/univero/fcache/fcache/cachepb"
+)
 
 // PeerPicker is the interface that must be implemented to
 // locate the peer that owns a specify key
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
+	// GetAll returns all the peers except this one
+	GetAll() []PeerGetter
 }
 
 // PeerGetter is the interface that must be implemented by a peer
 // And get cache from a peer
 type PeerGetter interface {
-	Get(in *pb.Request, out *pb.Response) error
+	Get(ctx context.Context, in *pb.Request, out *pb.Response) error
+	// Remove drops the key from the mainCache and the hotCache of the peer
+	Remove(ctx context.Context, in *pb.Request) error
+	// GetMany gets the values of all keys in one request
+	GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error
+	// String returns the name of the peer for the logs
+	String() string
+}
+
+// ReplicaPicker is a PeerPicker which knows the replicas of a key,
+// the Group with a replication factor checks whether its PeerPicker implements it
+type ReplicaPicker interface {
+	PeerPicker
+	// PickPeers returns the owners of the key in order up to n, the primary comes first,
+	// it stops at this peer and reports whether this peer is one of the owners
+	PickPeers(key string, n int) (peers []PeerGetter, self bool)
 }
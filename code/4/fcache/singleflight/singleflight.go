@@ -1,22 +1,86 @@
 package singleflight
 
-import "sync"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// errGoexit is the error of the call whose fn called runtime.Goexit
+var errGoexit = errors.New("runtime.Goexit was called")
+
+// A PanicError is the error of the call whose fn panicked,
+// it's re-panicked in every caller of Do and received by the callers of DoChan and DoContext
+type PanicError struct {
+	Value any
+	// Stack is the stack trace of the panic, it isn't in the Error, which may be sent to the users
+	Stack []byte
+}
+
+// Error returns the panic value only
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// Unwrap returns the panic value if it's an error
+func (p *PanicError) Unwrap() error {
+	err, ok := p.Value.(error)
+	if !ok {
+		return nil
+	}
+	return err
+}
+
+func newPanicError(v any) error {
+	stack := debug.Stack()
+	// the first line of the stack trace is "goroutine N [status]:",
+	// it's dropped since the panic may be re-panicked in another goroutine
+	if line := bytes.IndexByte(stack, '\n'); line >= 0 {
+		stack = stack[line+1:]
+	}
+	return &PanicError{Value: v, Stack: stack}
+}
 
 // call represent the doing or done request
 type call struct {
-	wg  sync.WaitGroup
-	val any
-	err error
+	// closed when the call is done
+	done chan struct{}
+	val  any
+	err  error
+	// the number of the callers which wait for this call
+	dups  int
+	chans []chan<- Result
+	// the callers still interested in the call, the call started by DoContext
+	// is cancelled when all of them go away
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func newCall() *call {
+	return &call{done: make(chan struct{}), waiters: 1}
 }
 
 // Group manage different key request
+// the API is the same as golang.org/x/sync/singleflight
 type Group struct {
 	mu sync.Mutex
 	m  map[string]*call
 }
 
+// Result holds the results of Do, so they can be passed on a channel
+type Result struct {
+	Val    any
+	Err    error
+	Shared bool
+}
+
 // Do make sure all required key call fn once at once time
-func (g *Group) Do(key string, fn func() (any, error)) (any, error) {
+// shared reports whether the result is given to more than one caller
+func (g *Group) Do(key string, fn func() (any, error)) (v any, err error, shared bool) {
 	// protected m
 	g.mu.Lock()
 	if g.m == nil {
@@ -24,24 +88,146 @@ func (g *Group) Do(key string, fn func() (any, error)) (any, error) {
 	}
 	// if some goroutine has required key, wait for value
 	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.waiters++
 		g.mu.Unlock()
-		c.wg.Wait()
-		return c.val, c.err
+		<-c.done
+		if e, ok := c.err.(*PanicError); ok {
+			panic(e)
+		} else if c.err == errGoexit {
+			runtime.Goexit()
+		}
+		return c.val, c.err, true
 	}
-	// if the key is first required, create a new call and add wait group lock
-	c := new(call)
-	c.wg.Add(1)
+	// if the key is first required, create a new call
+	c := newCall()
 	g.m[key] = c
 	g.mu.Unlock()
 
-	// only this call do fn
-	c.val, c.err = fn()
-	c.wg.Done()
+	g.doCall(c, key, fn)
+	if e, ok := c.err.(*PanicError); ok {
+		panic(e)
+	}
+	return c.val, c.err, c.dups > 0
+}
 
-	// delete the map of key to call
+// DoChan is like Do but returns a channel that will receive the result when it's ready,
+// the channel won't be closed
+func (g *Group) DoChan(key string, fn func() (any, error)) <-chan Result {
+	ch := make(chan Result, 1)
 	g.mu.Lock()
-	delete(g.m, key)
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.waiters++
+		c.chans = append(c.chans, ch)
+		g.mu.Unlock()
+		return ch
+	}
+	c := newCall()
+	c.chans = []chan<- Result{ch}
+	g.m[key] = c
+	g.mu.Unlock()
+
+	go g.doCall(c, key, fn)
+	return ch
+}
+
+// DoContext is like Do, but the caller returns ctx.Err() at once when its ctx is done,
+// while the call keeps running for the other callers,
+// fn gets a context which is cancelled only when all callers go away,
+// it carries the values of the ctx of the first caller but not its deadline,
+// fn runs in another goroutine, so its panic is returned as a *PanicError
+func (g *Group) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (any, error)) (v any, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	c, ok := g.m[key]
+	if ok {
+		c.dups++
+		c.waiters++
+	} else {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = newCall()
+		c.cancel = cancel
+		g.m[key] = c
+		go g.doCall(c, key, func() (any, error) {
+			return fn(callCtx)
+		})
+	}
 	g.mu.Unlock()
 
-	return c.val, c.err
+	select {
+	case <-c.done:
+		return c.val, c.err, c.dups > 0
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 && c.cancel != nil {
+			// nobody is interested in the call, the later callers start a new one
+			c.cancel()
+			if g.m[key] == c {
+				delete(g.m, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err(), false
+	}
+}
+
+// doCall calls fn and hands the result to all callers,
+// the call is always removed even if fn panics or calls runtime.Goexit, so the later callers don't hang
+func (g *Group) doCall(c *call, key string, fn func() (any, error)) {
+	normalReturn := false
+	recovered := false
+
+	defer func() {
+		// fn called runtime.Goexit, which can't be recovered
+		if !normalReturn && !recovered {
+			c.err = errGoexit
+		}
+
+		// delete the map of key to call, unless it's forgotten and replaced by a new call
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		close(c.done)
+		if c.cancel != nil {
+			c.cancel()
+		}
+		if g.m[key] == c {
+			delete(g.m, key)
+		}
+		for _, ch := range c.chans {
+			ch <- Result{Val: c.val, Err: c.err, Shared: c.dups > 0}
+		}
+	}()
+
+	func() {
+		defer func() {
+			if !normalReturn {
+				// recover returns nil for runtime.Goexit
+				if r := recover(); r != nil {
+					c.err = newPanicError(r)
+				}
+			}
+		}()
+		// only this call do fn
+		c.val, c.err = fn()
+		normalReturn = true
+	}()
+
+	if !normalReturn {
+		recovered = true
+	}
+}
+
+// Forget tells the Group to forget the key, the later calls of the key will call fn
+// rather than waiting for the earlier call to complete
+func (g *Group) Forget(key string) {
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
 }
@@ -0,0 +1,279 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	v, err, shared := g.Do("key", func() (any, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil || shared {
+		t.Fatalf("Do = %v, %v, %v, want bar, nil, false", v, err, shared)
+	}
+}
+
+func TestDoErr(t *testing.T) {
+	var g Group
+	someErr := errors.New("some error")
+	v, err, _ := g.Do("key", func() (any, error) {
+		return nil, someErr
+	})
+	if err != someErr || v != nil {
+		t.Fatalf("Do = %v, %v, want nil, %v", v, err, someErr)
+	}
+}
+
+func TestDoDupSuppress(t *testing.T) {
+	var g Group
+	var calls, shares atomic.Int32
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err, shared := g.Do("key", func() (any, error) {
+				calls.Add(1)
+				<-block
+				return "bar", nil
+			})
+			if v != "bar" || err != nil {
+				t.Errorf("Do = %v, %v", v, err)
+			}
+			if shared {
+				shares.Add(1)
+			}
+		}()
+	}
+	// let the callers join the flight
+	time.Sleep(50 * time.Millisecond)
+	close(block)
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Fatalf("fn should be called once, but %d got", calls.Load())
+	}
+	if shares.Load() != 10 {
+		t.Fatalf("all callers should share the result, but %d got", shares.Load())
+	}
+}
+
+func TestDoChan(t *testing.T) {
+	var g Group
+	block := make(chan struct{})
+	ch1 := g.DoChan("key", func() (any, error) {
+		<-block
+		return "bar", nil
+	})
+	ch2 := g.DoChan("key", func() (any, error) {
+		t.Error("fn of the second call shouldn't be called")
+		return nil, nil
+	})
+	select {
+	case <-ch1:
+		t.Fatal("the result shouldn't be ready before fn returns")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(block)
+	for _, ch := range []<-chan Result{ch1, ch2} {
+		if res := <-ch; res.Val != "bar" || res.Err != nil || !res.Shared {
+			t.Fatalf("DoChan = %+v, want bar, nil, true", res)
+		}
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group
+	block := make(chan struct{})
+	first := g.DoChan("key", func() (any, error) {
+		<-block
+		return 1, nil
+	})
+	g.Forget("key")
+
+	// the forgotten flight doesn't pin the later call
+	v, _, _ := g.Do("key", func() (any, error) {
+		return 2, nil
+	})
+	if v != 2 {
+		t.Fatalf("the call after Forget should call its fn, but %v got", v)
+	}
+	close(block)
+	if res := <-first; res.Val != 1 {
+		t.Fatalf("the forgotten call should still get its result, but %v got", res.Val)
+	}
+}
+
+func TestPanicDo(t *testing.T) {
+	var g Group
+	block := make(chan struct{})
+	fn := func() (any, error) {
+		<-block
+		panic("invalid memory address or nil pointer dereference")
+	}
+
+	const n = 5
+	var wg sync.WaitGroup
+	var panics atomic.Int32
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					if _, ok := r.(*PanicError); !ok {
+						t.Errorf("the panic should be a *PanicError, but %T got", r)
+					}
+					panics.Add(1)
+				}
+			}()
+			g.Do("key", fn)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(block)
+	wg.Wait()
+	if panics.Load() != n {
+		t.Fatalf("every caller should panic, but %d got", panics.Load())
+	}
+
+	// the key isn't pinned by the panicked call
+	if v, _, _ := g.Do("key", func() (any, error) { return "bar", nil }); v != "bar" {
+		t.Fatalf("the call after the panic should call its fn, but %v got", v)
+	}
+}
+
+func TestPanicDoChan(t *testing.T) {
+	var g Group
+	someErr := errors.New("some error")
+	res := <-g.DoChan("key", func() (any, error) {
+		panic(someErr)
+	})
+	var pe *PanicError
+	if !errors.As(res.Err, &pe) || !errors.Is(res.Err, someErr) {
+		t.Fatalf("the panic should be received as a *PanicError wrapping the value, but %v got", res.Err)
+	}
+	if len(pe.Stack) == 0 {
+		t.Fatal("the stack of the panic should be kept")
+	}
+}
+
+func TestGoexitDo(t *testing.T) {
+	var g Group
+	block := make(chan struct{})
+	done := make(chan struct{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			g.Do("key", func() (any, error) {
+				<-block
+				runtime.Goexit()
+				return nil, nil
+			})
+			t.Error("the caller should exit with the call")
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(block)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("the callers shouldn't hang after runtime.Goexit")
+		}
+	}
+	if v, _, _ := g.Do("key", func() (any, error) { return "bar", nil }); v != "bar" {
+		t.Fatalf("the call after runtime.Goexit should call its fn, but %v got", v)
+	}
+}
+
+func TestDoContextWaiterCancel(t *testing.T) {
+	var g Group
+	block := make(chan struct{})
+	var callCancelled atomic.Bool
+	fn := func(ctx context.Context) (any, error) {
+		select {
+		case <-block:
+			return "bar", nil
+		case <-ctx.Done():
+			callCancelled.Store(true)
+			return nil, ctx.Err()
+		}
+	}
+
+	res := make(chan any, 1)
+	go func() {
+		v, _, _ := g.DoContext(context.Background(), "key", fn)
+		res <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// the waiter goes away at once, the call keeps running for the first caller
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err, _ := g.DoContext(ctx, "key", fn); !errors.Is(err, context.Canceled) {
+		t.Fatalf("the cancelled waiter should return ctx.Err(), but %v got", err)
+	}
+	close(block)
+	if v := <-res; v != "bar" || callCancelled.Load() {
+		t.Fatalf("the call shouldn't be cancelled while a caller waits, but %v got", v)
+	}
+}
+
+func TestDoContextCancelCall(t *testing.T) {
+	var g Group
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			if _, err, _ := g.DoContext(ctx, "key", fn); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("the caller should return ctx.Err(), but %v got", err)
+			}
+		}()
+	}
+	wg.Wait()
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the call should be cancelled when all callers go away")
+	}
+
+	// the cancelled call isn't joined by the later callers
+	v, err, _ := g.DoContext(context.Background(), "key", func(ctx context.Context) (any, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil {
+		t.Fatalf("the call after the cancellation should call its fn, but %v, %v got", v, err)
+	}
+}
+
+func TestDoContextPanic(t *testing.T) {
+	var g Group
+	_, err, _ := g.DoContext(context.Background(), "key", func(ctx context.Context) (any, error) {
+		panic("boom")
+	})
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Value != "boom" {
+		t.Fatalf("the panic should be returned as a *PanicError, but %v got", err)
+	}
+	if err.Error() != "panic: boom" || len(pe.Stack) == 0 {
+		t.Fatalf("the stack should be kept out of the error message, but %q got", err.Error())
+	}
+}
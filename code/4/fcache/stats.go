@@ -0,0 +1,88 @@
+package fcache
+
+import "sync/atomic"
+
+// Stats are the counters of a group
+type Stats struct {
+	// Gets any Get request, including from peers
+	Gets int64
+	// CacheHits either the mainCache or the hotCache is hit
+	CacheHits int64
+	// PeerLoads either remote load or remote cache hit, not an error
+	PeerLoads int64
+	// PeerErrors the failed requests to the peers
+	PeerErrors int64
+	// LocalLoads the successful loads by the getter
+	LocalLoads int64
+	// LocalLoadErrs the failed loads by the getter
+	LocalLoadErrs int64
+	// LoadsDeduped the loads which wait for the same key loaded by another request
+	LoadsDeduped int64
+	// ServerRequests the requests served for the peers by the HttpPool
+	ServerRequests int64
+}
+
+// groupStats are the counters updated atomically
+type groupStats struct {
+	gets           atomic.Int64
+	cacheHits      atomic.Int64
+	peerLoads      atomic.Int64
+	peerErrors     atomic.Int64
+	localLoads     atomic.Int64
+	localLoadErrs  atomic.Int64
+	loadsDeduped   atomic.Int64
+	serverRequests atomic.Int64
+}
+
+// snapshot reads all counters
+func (s *groupStats) snapshot() Stats {
+	return Stats{
+		Gets:           s.gets.Load(),
+		CacheHits:      s.cacheHits.Load(),
+		PeerLoads:      s.peerLoads.Load(),
+		PeerErrors:     s.peerErrors.Load(),
+		LocalLoads:     s.localLoads.Load(),
+		LocalLoadErrs:  s.localLoadErrs.Load(),
+		LoadsDeduped:   s.loadsDeduped.Load(),
+		ServerRequests: s.serverRequests.Load(),
+	}
+}
+
+// CacheStats are the statistics of a cache
+type CacheStats struct {
+	// Bytes both the length of key and value are counted
+	Bytes int64
+	// Items the number of entries
+	Items int64
+	Gets  int64
+	Hits  int64
+	// Evictions the entries evicted by the policy, expired or removed
+	Evictions int64
+}
+
+// CacheType marks the mainCache or the hotCache
+type CacheType int
+
+const (
+	// MainCache keeps the keys owned by this peer
+	MainCache CacheType = iota + 1
+	// HotCache keeps the popular keys owned by the other peers
+	HotCache
+)
+
+// Stats returns a snapshot of the counters of the group
+func (g *Group) Stats() Stats {
+	return g.stats.snapshot()
+}
+
+// CacheStats returns the statistics of the mainCache or the hotCache
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	default:
+		return CacheStats{}
+	}
+}
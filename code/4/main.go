@@ -1,11 +1,15 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/univero/fcache/fcache"
+	"github.com/univero/fcache/fcache/gossip"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
 var db = map[string]string{
@@ -21,13 +25,32 @@ func createGroup() *fcache.Group {
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
-		}))
+			return nil, fmt.Errorf("%s not exist: %w", key, fcache.ErrNotFound)
+		}), fcache.WithNegativeCache(time.Minute))
 }
 
 func startCacheServer(addr string, addrs []string, fc *fcache.Group) {
 	peers := fcache.NewHttpPool(addr)
 	peers.Set(addrs...)
+	serveCache(addr, peers, fc)
+}
+
+// startGossipCacheServer finds the peers by gossip instead of the static addrs
+func startGossipCacheServer(addr, gossipAddr, seed string, fc *fcache.Group) {
+	peers := fcache.NewHttpPool(addr)
+	members, err := gossip.New(gossip.Config{Name: addr, BindAddr: gossipAddr, Peers: peers})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if seed != "" {
+		if err := members.Join(strings.Split(seed, ",")...); err != nil {
+			log.Fatal(err)
+		}
+	}
+	serveCache(addr, peers, fc)
+}
+
+func serveCache(addr string, peers *fcache.HttpPool, fc *fcache.Group) {
 	fc.RegisterPeers(peers)
 	log.Println("fcache is running at", addr)
 	log.Fatal(http.ListenAndServe(addr[7:], peers))
@@ -37,7 +60,11 @@ func startAPIServer(apiAddr string, gee *fcache.Group) {
 	http.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			key := r.URL.Query().Get("key")
-			view, err := gee.Get(key)
+			view, err := gee.Get(r.Context(), key)
+			if errors.Is(err, fcache.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -54,8 +81,11 @@ func startAPIServer(apiAddr string, gee *fcache.Group) {
 func main() {
 	var port int
 	var api bool
+	var gossipAddr, seed string
 	flag.IntVar(&port, "port", 8001, "Geecache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
+	flag.StringVar(&gossipAddr, "gossip", "", "UDP address of the gossip, the peers are found by gossip if it's set")
+	flag.StringVar(&seed, "seed", "", "UDP addresses of the gossip seeds to join, separated by comma")
 	flag.Parse()
 
 	apiAddr := "http://localhost:9999"
@@ -74,5 +104,9 @@ func main() {
 	if api {
 		go startAPIServer(apiAddr, gee)
 	}
+	if gossipAddr != "" {
+		startGossipCacheServer(fmt.Sprintf("http://localhost:%d", port), gossipAddr, seed, gee)
+		return
+	}
 	startCacheServer(addrMap[port], []string(addrs), gee)
 }